@@ -13,26 +13,74 @@ func printUsage() {
 	fmt.Println("DSW - Do Something When")
 	fmt.Println("\nUsage:")
 	fmt.Println("  dsw create <name> <command>     Create a single action")
+	fmt.Println("    [-force] [-shell] [-timeout 30m] [-workdir d] [-env K=V]")
+	fmt.Println("    [-cooldown 10s] [-concurrency p] [-retry n]")
+	fmt.Println("    [-retry-delay 1s] [-retry-backoff fixed|exponential]")
 	fmt.Println("  dsw create -f <file.yaml>       Create actions from YAML file")
+	fmt.Println("  dsw list [-json]                List actions")
+	fmt.Println("  dsw show <name>                 Show an action")
+	fmt.Println("  dsw edit <name>                 Edit an action in $EDITOR")
+	fmt.Println("  dsw rename <old> <new>          Rename an action")
+	fmt.Println("  dsw delete <name>               Delete an action")
+	fmt.Println("  dsw run <name> [-param K=V]     Run an action (through the local socket when available)")
+	fmt.Println("    [-json] [-async] [-dry-run] [-local]")
 	fmt.Println("  dsw serve [-p 8080] [-d]        Start HTTP API server")
+	fmt.Println("    [-listen host:port|none] [-socket] [-max-parallel n]")
+	fmt.Println("    [-tls-cert f -tls-key f] [-client-ca f]")
 	fmt.Println("  dsw stop                        Stop daemon server")
+	fmt.Println("  dsw status [-p 8080]            Show daemon and server health")
+	fmt.Println("  dsw jobs [-p 8080] [job-id]     List jobs or show one")
+	fmt.Println("  dsw cancel [-p 8080] <job-id>   Cancel a running job")
+	fmt.Println("  dsw history [-action a]         Show past executions")
+	fmt.Println("    [-status s] [-since 24h] [-limit n] [-json]")
+	fmt.Println("  dsw schedule list [-p 8080]     List scheduled triggers")
 	fmt.Println("  dsw boot enable [-p 8080]       Enable boot service")
+	fmt.Println("    [-listen host:port|none] [-socket] [-max-parallel n]")
+	fmt.Println("    [-tls-cert f -tls-key f] [-client-ca f]")
 	fmt.Println("  dsw boot disable                Disable boot service")
+	fmt.Println("  dsw token create [-scope p] <n> Create an API token")
+	fmt.Println("  dsw token list                  List API tokens")
+	fmt.Println("  dsw token revoke <name>         Revoke an API token")
+	fmt.Println("  dsw remote add <name> <url>     Save a remote server profile")
+	fmt.Println("    [-t token] [-ca f] [-cert f -key f]")
+	fmt.Println("  dsw remote list                 List remote server profiles")
+	fmt.Println("  dsw remote remove <name>        Remove a remote server profile")
 	fmt.Println("  dsw version                     Show version")
+	fmt.Println("\nRemote mode (list, run, jobs, cancel, status, history against a running server):")
+	fmt.Println("  dsw --remote <url> [--token t] <command>")
+	fmt.Println("  dsw --profile <name> <command>")
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		printUsage()
+func runRemote(apiClient *services.ApiClient, arguments []string) {
+	remoteCommandHandler := services.NewRemoteCommandHandler(apiClient, arguments)
+
+	switch arguments[0] {
+	case "list":
+		remoteCommandHandler.List()
+	case "run":
+		remoteCommandHandler.Run()
+	case "jobs":
+		remoteCommandHandler.Jobs()
+	case "cancel":
+		remoteCommandHandler.Cancel()
+	case "status":
+		remoteCommandHandler.Status()
+	case "history":
+		remoteCommandHandler.History()
+	default:
+		fmt.Fprintf(os.Stderr, "Error: command not available in remote mode: %s\n", arguments[0])
 		os.Exit(1)
 	}
+}
 
-	command := os.Args[1]
-	configuration := services.NewConfiguration()
-	err := configuration.Load()
+func main() {
 	var version bool
 	flag.BoolVar(&version, "version", false, "Show version information")
 	flag.BoolVar(&version, "v", false, "Show version information (shorthand)")
+	remoteURL := flag.String("remote", "", "Run the command against a remote dsw server URL")
+	token := flag.String("token", "", "API token for the remote server (defaults to $DSW_TOKEN)")
+	profile := flag.String("profile", "", "Remote server profile saved with dsw remote add")
+	flag.Usage = printUsage
 	flag.Parse()
 
 	if version {
@@ -40,24 +88,69 @@ func main() {
 		return
 	}
 
+	arguments := flag.Args()
+	if len(arguments) < 1 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	apiClient, err := services.ResolveRemoteClient(*remoteURL, *token, *profile)
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if apiClient != nil {
+		runRemote(apiClient, arguments)
+		return
+	}
+
+	command := arguments[0]
+	configuration := services.NewConfiguration()
+	if err := configuration.Load(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	validator := services.NewValidator()
 	daemon := services.NewDaemon(configuration)
-	commandHandler := services.NewCommandHandler(configuration, validator, daemon)
+	commandHandler := services.NewCommandHandler(configuration, validator, daemon, arguments)
 
 	switch command {
 	case "create":
 		commandHandler.Create()
+	case "list":
+		commandHandler.List()
+	case "show":
+		commandHandler.Show()
+	case "edit":
+		commandHandler.Edit()
+	case "rename":
+		commandHandler.Rename()
+	case "delete":
+		commandHandler.Delete()
+	case "run":
+		commandHandler.Run()
 	case "serve":
 		commandHandler.Serve()
 	case "stop":
 		commandHandler.ServerStop()
+	case "status":
+		commandHandler.Status()
+	case "jobs":
+		commandHandler.Jobs()
+	case "history":
+		commandHandler.History()
+	case "cancel":
+		commandHandler.Cancel()
+	case "schedule":
+		commandHandler.HandleSchedule()
 	case "boot":
 		commandHandler.HandleBoot()
+	case "token":
+		commandHandler.HandleToken()
+	case "remote":
+		commandHandler.HandleRemote()
 	case "version":
 		fmt.Printf("v%s\n", models.VERSION)
 	default:
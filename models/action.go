@@ -1,6 +1,80 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
+type ConcurrencyPolicy string
+
+const (
+	ConcurrencyAllow   ConcurrencyPolicy = "allow"
+	ConcurrencyReject  ConcurrencyPolicy = "reject"
+	ConcurrencyQueue   ConcurrencyPolicy = "queue"
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+)
+
 type Action struct {
-	Command string   `yaml:"command" mapstructure:"command"`
-	Args    []string `yaml:"args" mapstructure:"args"`
+	Command     string               `yaml:"command,omitempty" json:"command,omitempty"`
+	Args        []string             `yaml:"args,omitempty" json:"args,omitempty"`
+	Shell       *bool                `yaml:"shell,omitempty" json:"shell,omitempty"`
+	Timeout     time.Duration        `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	WorkDir     string               `yaml:"workdir,omitempty" json:"workdir,omitempty"`
+	Env         map[string]string    `yaml:"env,omitempty" json:"-"`
+	Parameters  map[string]Parameter `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	Webhook     *Webhook             `yaml:"webhook,omitempty" json:"webhook,omitempty"`
+	Concurrency ConcurrencyPolicy    `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+	RateLimit   *RateLimit           `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	Cooldown    time.Duration        `yaml:"cooldown,omitempty" json:"cooldown,omitempty"`
+	Retry       *RetryPolicy         `yaml:"retry,omitempty" json:"retry,omitempty"`
+	Workflow    []WorkflowStep       `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+}
+
+// actionJSON writes the durations of an action as strings; its fields shadow
+// the ones of the embedded action.
+type actionJSON struct {
+	*plainAction
+	Timeout  jsonDuration `json:"timeout,omitempty"`
+	Cooldown jsonDuration `json:"cooldown,omitempty"`
+}
+
+type plainAction Action
+
+func (action Action) MarshalJSON() ([]byte, error) {
+	return json.Marshal(actionJSON{
+		plainAction: (*plainAction)(&action),
+		Timeout:     jsonDuration(action.Timeout),
+		Cooldown:    jsonDuration(action.Cooldown),
+	})
+}
+
+func (action *Action) UnmarshalJSON(data []byte) error {
+	decoded := actionJSON{
+		plainAction: (*plainAction)(action),
+		Timeout:     jsonDuration(action.Timeout),
+		Cooldown:    jsonDuration(action.Cooldown),
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	action.Timeout = time.Duration(decoded.Timeout)
+	action.Cooldown = time.Duration(decoded.Cooldown)
+	return nil
+}
+
+// UsesShell keeps actions saved before the shell option existed on "sh -c".
+func (action Action) UsesShell() bool {
+	return action.Shell == nil || *action.Shell
+}
+
+// IsWorkflow reports whether the action runs other actions as steps instead
+// of a command.
+func (action Action) IsWorkflow() bool {
+	return len(action.Workflow) > 0
+}
+
+// IsExclusive reports whether runs of the action must not overlap.
+func (action Action) IsExclusive() bool {
+	return action.Concurrency != "" && action.Concurrency != ConcurrencyAllow
 }
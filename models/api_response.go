@@ -1,8 +1,36 @@
 package models
 
 type ApiResponse struct {
+	Success    bool            `json:"success"`
+	Output     string          `json:"output"`
+	Message    string          `json:"message"`
+	ExitCode   int             `json:"exit_code"`
+	TimedOut   bool            `json:"timed_out,omitempty"`
+	Cancelled  bool            `json:"cancelled,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+	Steps      []StepResult    `json:"steps,omitempty"`
+	Attempts   []AttemptResult `json:"attempts,omitempty"`
+}
+
+type AttemptResult struct {
+	Attempt    int    `json:"attempt"`
+	Success    bool   `json:"success"`
+	Output     string `json:"output"`
+	Message    string `json:"message"`
+	ExitCode   int    `json:"exit_code"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Cancelled  bool   `json:"cancelled,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type StepResult struct {
+	Step       string `json:"step"`
+	Action     string `json:"action"`
 	Success    bool   `json:"success"`
 	Output     string `json:"output"`
 	Message    string `json:"message"`
+	ExitCode   int    `json:"exit_code"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Cancelled  bool   `json:"cancelled,omitempty"`
 	DurationMs int64  `json:"duration_ms"`
 }
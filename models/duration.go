@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// jsonDuration writes durations in API responses the way they are written in
+// the configuration, such as "30s", instead of in nanoseconds.
+type jsonDuration time.Duration
+
+func (duration jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+func (duration *jsonDuration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+
+	*duration = jsonDuration(parsed)
+	return nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type ConfigurationStatus struct {
+	Actions         int        `json:"actions"`
+	Triggers        int        `json:"triggers"`
+	LoadedAt        time.Time  `json:"loaded_at"`
+	LastReloadAt    *time.Time `json:"last_reload_at,omitempty"`
+	LastReloadError string     `json:"last_reload_error,omitempty"`
+}
+
+type HealthStatus struct {
+	Status        string              `json:"status"`
+	Version       string              `json:"version"`
+	StartedAt     time.Time           `json:"started_at"`
+	UptimeSeconds int64               `json:"uptime_seconds"`
+	Configuration ConfigurationStatus `json:"configuration"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type HistoryEntry struct {
+	JobID           string    `json:"job_id"`
+	Action          string    `json:"action"`
+	Source          string    `json:"source"`
+	Caller          string    `json:"caller,omitempty"`
+	RequestID       string    `json:"request_id,omitempty"`
+	Status          JobState  `json:"status"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationMs      int64     `json:"duration_ms"`
+	ExitCode        int       `json:"exit_code"`
+	Message         string    `json:"message"`
+	Output          string    `json:"output,omitempty"`
+	OutputTruncated bool      `json:"output_truncated,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobTimedOut  JobState = "timed_out"
+	JobCancelled JobState = "cancelled"
+	// JobRejected only appears in the history, for runs that the action's
+	// concurrency policy refused.
+	JobRejected JobState = "rejected"
+)
+
+type Job struct {
+	ID            string       `json:"id"`
+	Action        string       `json:"action"`
+	State         JobState     `json:"state"`
+	CreatedAt     time.Time    `json:"created_at"`
+	StartedAt     *time.Time   `json:"started_at,omitempty"`
+	FinishedAt    *time.Time   `json:"finished_at,omitempty"`
+	Result        *ApiResponse `json:"result,omitempty"`
+	QueuePosition int          `json:"queue_position,omitempty"`
+}
+
+func (job Job) IsFinished() bool {
+	return job.State != JobQueued && job.State != JobRunning
+}
@@ -0,0 +1,51 @@
+package models
+
+type NotifierType string
+
+const (
+	NotifierWebhook NotifierType = "webhook"
+	NotifierNtfy    NotifierType = "ntfy"
+	NotifierGotify  NotifierType = "gotify"
+	NotifierSMTP    NotifierType = "smtp"
+)
+
+type NotifyCondition string
+
+const (
+	NotifyAlways   NotifyCondition = "always"
+	NotifyFailure  NotifyCondition = "failure"
+	NotifyTimeout  NotifyCondition = "timeout"
+	NotifyRecovery NotifyCondition = "recovery"
+)
+
+// Notifier sends a message when a run of one of Actions (names or glob
+// patterns, all actions when empty) meets one of the On conditions.
+type Notifier struct {
+	Type    NotifierType      `yaml:"type"`
+	URL     string            `yaml:"url,omitempty"`
+	Token   string            `yaml:"token,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	SMTP    *SMTPSettings     `yaml:"smtp,omitempty"`
+	On      []NotifyCondition `yaml:"on,omitempty"`
+	Actions []string          `yaml:"actions,omitempty"`
+	Title   string            `yaml:"title,omitempty"`
+	Message string            `yaml:"message,omitempty"`
+}
+
+type SMTPSettings struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Conditions defaults to notifying on failures only.
+func (notifier Notifier) Conditions() []NotifyCondition {
+	if len(notifier.On) == 0 {
+		return []NotifyCondition{NotifyFailure}
+	}
+
+	return notifier.On
+}
@@ -0,0 +1,20 @@
+package models
+
+type ParameterType string
+
+const (
+	ParameterString ParameterType = "string"
+	ParameterInt    ParameterType = "int"
+	ParameterBool   ParameterType = "bool"
+	ParameterEnum   ParameterType = "enum"
+)
+
+type Parameter struct {
+	Type     ParameterType `yaml:"type" json:"type"`
+	Required bool          `yaml:"required,omitempty" json:"required,omitempty"`
+	Default  string        `yaml:"default,omitempty" json:"default,omitempty"`
+	Min      *int          `yaml:"min,omitempty" json:"min,omitempty"`
+	Max      *int          `yaml:"max,omitempty" json:"max,omitempty"`
+	Pattern  string        `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Values   []string      `yaml:"values,omitempty" json:"values,omitempty"`
+}
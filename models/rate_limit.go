@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RateLimit allows Requests per Per on average, with bursts of up to Burst
+// requests (defaulting to Requests).
+type RateLimit struct {
+	Requests int           `yaml:"requests" json:"requests"`
+	Per      time.Duration `yaml:"per" json:"per"`
+	Burst    int           `yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+type rateLimitJSON struct {
+	*plainRateLimit
+	Per jsonDuration `json:"per"`
+}
+
+type plainRateLimit RateLimit
+
+func (rateLimit RateLimit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rateLimitJSON{
+		plainRateLimit: (*plainRateLimit)(&rateLimit),
+		Per:            jsonDuration(rateLimit.Per),
+	})
+}
+
+func (rateLimit *RateLimit) UnmarshalJSON(data []byte) error {
+	decoded := rateLimitJSON{
+		plainRateLimit: (*plainRateLimit)(rateLimit),
+		Per:            jsonDuration(rateLimit.Per),
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	rateLimit.Per = time.Duration(decoded.Per)
+	return nil
+}
+
+func (rateLimit RateLimit) BurstSize() int {
+	if rateLimit.Burst > 0 {
+		return rateLimit.Burst
+	}
+
+	return rateLimit.Requests
+}
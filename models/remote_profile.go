@@ -0,0 +1,9 @@
+package models
+
+type RemoteProfile struct {
+	URL        string `yaml:"url"`
+	Token      string `yaml:"token,omitempty"`
+	CA         string `yaml:"ca,omitempty"`
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type BackoffStrategy string
+
+const (
+	BackoffFixed       BackoffStrategy = "fixed"
+	BackoffExponential BackoffStrategy = "exponential"
+)
+
+const defaultRetryDelay = time.Second
+
+// RetryPolicy runs an action up to Attempts times. Without ExitCodes or
+// OnTimeout every failure is retried; with them only the listed exit codes
+// and, when OnTimeout is set, timeouts are. Cancelled runs are never retried.
+type RetryPolicy struct {
+	Attempts  int             `yaml:"attempts" json:"attempts"`
+	Backoff   BackoffStrategy `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+	Delay     time.Duration   `yaml:"delay,omitempty" json:"delay,omitempty"`
+	MaxDelay  time.Duration   `yaml:"max_delay,omitempty" json:"max_delay,omitempty"`
+	Jitter    float64         `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	ExitCodes []int           `yaml:"exit_codes,omitempty" json:"exit_codes,omitempty"`
+	OnTimeout bool            `yaml:"on_timeout,omitempty" json:"on_timeout,omitempty"`
+}
+
+type retryPolicyJSON struct {
+	*plainRetryPolicy
+	Delay    jsonDuration `json:"delay,omitempty"`
+	MaxDelay jsonDuration `json:"max_delay,omitempty"`
+}
+
+type plainRetryPolicy RetryPolicy
+
+func (retryPolicy RetryPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(retryPolicyJSON{
+		plainRetryPolicy: (*plainRetryPolicy)(&retryPolicy),
+		Delay:            jsonDuration(retryPolicy.Delay),
+		MaxDelay:         jsonDuration(retryPolicy.MaxDelay),
+	})
+}
+
+func (retryPolicy *RetryPolicy) UnmarshalJSON(data []byte) error {
+	decoded := retryPolicyJSON{
+		plainRetryPolicy: (*plainRetryPolicy)(retryPolicy),
+		Delay:            jsonDuration(retryPolicy.Delay),
+		MaxDelay:         jsonDuration(retryPolicy.MaxDelay),
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	retryPolicy.Delay = time.Duration(decoded.Delay)
+	retryPolicy.MaxDelay = time.Duration(decoded.MaxDelay)
+	return nil
+}
+
+func (retryPolicy RetryPolicy) InitialDelay() time.Duration {
+	if retryPolicy.Delay > 0 {
+		return retryPolicy.Delay
+	}
+
+	return defaultRetryDelay
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type ScheduleStatus struct {
+	Trigger   string     `json:"trigger"`
+	Action    string     `json:"action"`
+	Schedule  string     `json:"schedule"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastJobID string     `json:"last_job_id,omitempty"`
+	LastState JobState   `json:"last_state,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+type ServerSettings struct {
+	Listen      string `yaml:"listen,omitempty"`
+	TLSCert     string `yaml:"tls_cert,omitempty"`
+	TLSKey      string `yaml:"tls_key,omitempty"`
+	ClientCA    string `yaml:"client_ca,omitempty"`
+	LocalCert   string `yaml:"local_cert,omitempty"`
+	LocalKey    string `yaml:"local_key,omitempty"`
+	Socket      bool   `yaml:"socket,omitempty"`
+	MaxParallel int    `yaml:"max_parallel,omitempty"`
+}
+
+func (settings ServerSettings) UsesTLS() bool {
+	return settings.TLSCert != "" || settings.TLSKey != ""
+}
@@ -0,0 +1,7 @@
+package models
+
+type Token struct {
+	Hash      string   `yaml:"hash"`
+	CreatedAt string   `yaml:"created_at"`
+	Scopes    []string `yaml:"scopes,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type Trigger struct {
+	Action     string            `yaml:"action" json:"action"`
+	Cron       string            `yaml:"cron,omitempty" json:"cron,omitempty"`
+	Timezone   string            `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	Interval   time.Duration     `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Watch      *Watch            `yaml:"watch,omitempty" json:"watch,omitempty"`
+	Parameters map[string]string `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+}
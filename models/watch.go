@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Watch struct {
+	Paths     []string      `yaml:"paths" json:"paths"`
+	Events    []string      `yaml:"events,omitempty" json:"events,omitempty"`
+	Debounce  time.Duration `yaml:"debounce,omitempty" json:"debounce,omitempty"`
+	Recursive bool          `yaml:"recursive,omitempty" json:"recursive,omitempty"`
+	Parameter string        `yaml:"parameter,omitempty" json:"parameter,omitempty"`
+}
@@ -0,0 +1,7 @@
+package models
+
+type Webhook struct {
+	Secret   string   `yaml:"secret" json:"-"`
+	Events   []string `yaml:"events,omitempty" json:"events,omitempty"`
+	Branches []string `yaml:"branches,omitempty" json:"branches,omitempty"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WorkflowEnd as an on_success or on_failure target stops the workflow.
+const WorkflowEnd = "end"
+
+// WorkflowStep runs one action, or several at once with Parallel. Without
+// edges a step continues with the next one on success and stops the workflow
+// on failure.
+type WorkflowStep struct {
+	Name      string            `yaml:"name" json:"name"`
+	Action    string            `yaml:"action,omitempty" json:"action,omitempty"`
+	Parallel  []string          `yaml:"parallel,omitempty" json:"parallel,omitempty"`
+	Params    map[string]string `yaml:"params,omitempty" json:"params,omitempty"`
+	Timeout   time.Duration     `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	OnSuccess string            `yaml:"on_success,omitempty" json:"on_success,omitempty"`
+	OnFailure string            `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
+}
+
+type workflowStepJSON struct {
+	*plainWorkflowStep
+	Timeout jsonDuration `json:"timeout,omitempty"`
+}
+
+type plainWorkflowStep WorkflowStep
+
+func (step WorkflowStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(workflowStepJSON{
+		plainWorkflowStep: (*plainWorkflowStep)(&step),
+		Timeout:           jsonDuration(step.Timeout),
+	})
+}
+
+func (step *WorkflowStep) UnmarshalJSON(data []byte) error {
+	decoded := workflowStepJSON{
+		plainWorkflowStep: (*plainWorkflowStep)(step),
+		Timeout:           jsonDuration(step.Timeout),
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	step.Timeout = time.Duration(decoded.Timeout)
+	return nil
+}
+
+func (step WorkflowStep) Actions() []string {
+	if step.Action != "" {
+		return []string{step.Action}
+	}
+
+	return step.Parallel
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const apiClientTimeout = 30 * time.Second
+
+type ApiClient struct {
+	baseURL         string
+	socketPath      string
+	token           string
+	httpClient      *http.Client
+	executionClient *http.Client
+}
+
+func NewApiClient(baseURL string, token string) *ApiClient {
+	return &ApiClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Timeout: apiClientTimeout,
+		},
+		// Executions last as long as the action's own timeout allows.
+		executionClient: &http.Client{},
+	}
+}
+
+// NewSocketApiClient talks to a local server over its Unix socket, where no
+// token is needed.
+func NewSocketApiClient(socketPath string) *ApiClient {
+	apiClient := NewApiClient("http://localhost", "")
+	apiClient.socketPath = socketPath
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+
+	apiClient.httpClient.Transport = transport
+	apiClient.executionClient.Transport = transport
+	return apiClient
+}
+
+func (apiClient *ApiClient) SetTLSConfig(tlsConfig *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	apiClient.httpClient.Transport = transport
+	apiClient.executionClient.Transport = transport
+}
+
+func (apiClient *ApiClient) BaseURL() string {
+	if apiClient.socketPath != "" {
+		return "unix://" + apiClient.socketPath
+	}
+
+	return apiClient.baseURL
+}
+
+func (apiClient *ApiClient) Health() (models.HealthStatus, error) {
+	var status models.HealthStatus
+	err := apiClient.do(http.MethodGet, "/healthz", nil, &status)
+	return status, err
+}
+
+func (apiClient *ApiClient) ListActions() (map[string]models.Action, error) {
+	var response ActionsResponse
+	err := apiClient.do(http.MethodGet, "/actions", nil, &response)
+	return response.Actions, err
+}
+
+func (apiClient *ApiClient) ListJobs() (JobsResponse, error) {
+	var response JobsResponse
+	err := apiClient.do(http.MethodGet, "/jobs", nil, &response)
+	return response, err
+}
+
+func (apiClient *ApiClient) GetJob(jobID string) (models.Job, error) {
+	var job models.Job
+	err := apiClient.do(http.MethodGet, "/jobs/"+url.PathEscape(jobID), nil, &job)
+	return job, err
+}
+
+func (apiClient *ApiClient) ListHistory(query url.Values) ([]models.HistoryEntry, error) {
+	var response HistoryResponse
+	err := apiClient.do(http.MethodGet, "/history?"+query.Encode(), nil, &response)
+	return response.Entries, err
+}
+
+func (apiClient *ApiClient) SubmitAction(actionName string, parameters map[string]string) (models.Job, error) {
+	body, err := encodeParameters(parameters)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	var job models.Job
+	err = apiClient.do(http.MethodPost, "/execute/"+url.PathEscape(actionName)+"?async=true", body, &job)
+	return job, err
+}
+
+// ExecuteAction waits for the action to finish. A failed command comes back as
+// 500 with a regular ApiResponse, which is a result rather than an error.
+func (apiClient *ApiClient) ExecuteAction(ctx context.Context, actionName string, parameters map[string]string) (models.ApiResponse, error) {
+	body, err := encodeParameters(parameters)
+	if err != nil {
+		return models.ApiResponse{}, err
+	}
+
+	request, err := apiClient.newRequest(ctx, http.MethodPost, "/execute/"+url.PathEscape(actionName), body)
+	if err != nil {
+		return models.ApiResponse{}, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := apiClient.send(apiClient.executionClient, request)
+	if err != nil {
+		return models.ApiResponse{}, err
+	}
+	defer response.Body.Close()
+
+	responseData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return models.ApiResponse{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result models.ApiResponse
+	if response.StatusCode == http.StatusOK || response.StatusCode == http.StatusInternalServerError {
+		if err := json.Unmarshal(responseData, &result); err == nil && result.Message != "" {
+			return result, nil
+		}
+	}
+
+	return models.ApiResponse{}, responseError(response, responseData)
+}
+
+// StreamAction runs the action through the event stream endpoint and calls
+// handleEvent for every event until the stream ends.
+func (apiClient *ApiClient) StreamAction(ctx context.Context, actionName string, parameters map[string]string, handleEvent func(event string, data string)) error {
+	body, err := encodeParameters(parameters)
+	if err != nil {
+		return err
+	}
+
+	request, err := apiClient.newRequest(ctx, http.MethodPost, "/execute/"+url.PathEscape(actionName), body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", eventStreamContentType)
+
+	response, err := apiClient.send(apiClient.executionClient, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		responseData, _ := io.ReadAll(response.Body)
+		return responseError(response, responseData)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var dataLines []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if event != "" {
+				handleEvent(event, strings.Join(dataLines, "\n"))
+			}
+			event = ""
+			dataLines = nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			dataLines = append(dataLines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream interrupted: %w", err)
+	}
+
+	return nil
+}
+
+func encodeParameters(parameters map[string]string) (io.Reader, error) {
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+
+	body, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode parameters: %w", err)
+	}
+
+	return bytes.NewReader(body), nil
+}
+
+func (apiClient *ApiClient) CancelJob(jobID string) (models.Job, error) {
+	var job models.Job
+	err := apiClient.do(http.MethodDelete, "/jobs/"+url.PathEscape(jobID), nil, &job)
+	return job, err
+}
+
+func (apiClient *ApiClient) ListSchedules() ([]models.ScheduleStatus, error) {
+	var response SchedulesResponse
+	err := apiClient.do(http.MethodGet, "/schedules", nil, &response)
+	return response.Schedules, err
+}
+
+func (apiClient *ApiClient) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, apiClient.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	if apiClient.token != "" {
+		request.Header.Set("Authorization", "Bearer "+apiClient.token)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return request, nil
+}
+
+func (apiClient *ApiClient) send(httpClient *http.Client, request *http.Request) (*http.Response, error) {
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach dsw server at %s: %w", apiClient.BaseURL(), err)
+	}
+
+	return response, nil
+}
+
+func responseError(response *http.Response, responseData []byte) error {
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(responseData, &errorResponse); err != nil || errorResponse.Error == "" {
+		return fmt.Errorf("server returned %s", response.Status)
+	}
+
+	return fmt.Errorf("server returned %s: %s", response.Status, errorResponse.Error)
+}
+
+func (apiClient *ApiClient) do(method string, path string, body io.Reader, result any) error {
+	request, err := apiClient.newRequest(context.Background(), method, path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := apiClient.send(apiClient.httpClient, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		responseData, _ := io.ReadAll(response.Body)
+		return responseError(response, responseData)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+const tokenPrefix = "dsw_"
+const tokenByteLength = 32
+
+type contextKey string
+
+const tokenNameContextKey contextKey = "tokenName"
+const tokenScopesContextKey contextKey = "tokenScopes"
+
+// metricsScope lets a scoped token read /metrics. Action names cannot contain
+// a colon, so it never matches an action.
+const metricsScope = ":metrics"
+
+func GenerateToken() (string, error) {
+	randomBytes := make([]byte, tokenByteLength)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return tokenPrefix + hex.EncodeToString(randomBytes), nil
+}
+
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+func tokenNameFromContext(ctx context.Context) string {
+	tokenName, _ := ctx.Value(tokenNameContextKey).(string)
+	return tokenName
+}
+
+func tokenScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(tokenScopesContextKey).([]string)
+	return scopes
+}
+
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if scope == "" {
+			return fmt.Errorf("scope cannot be empty")
+		}
+
+		if _, err := path.Match(scope, ""); err != nil {
+			return fmt.Errorf("invalid scope pattern %q: %w", scope, err)
+		}
+	}
+
+	return nil
+}
+
+func isActionInScope(scopes []string, actionName string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range scopes {
+		if matched, err := path.Match(scope, actionName); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorizeMetrics admits tokens that can run every action, since metrics
+// name all of them, and scoped tokens that were granted metricsScope.
+func (serverHandler *ServerHandler) authorizeMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		scopes := tokenScopesFromContext(request.Context())
+		if len(scopes) > 0 && !slices.Contains(scopes, metricsScope) {
+			serverHandler.Server.respondError(responseWriter, "token not allowed to read metrics", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(responseWriter, request)
+	})
+}
+
+// authenticate requires a bearer token on TCP. Requests over the Unix socket
+// get full access without one: only the owner of the 0600 socket can connect,
+// and that user can read the configuration anyway.
+func (serverHandler *ServerHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if isLocalConnection(request.Context()) {
+			ctx := context.WithValue(request.Context(), tokenNameContextKey, localCallerName)
+			next.ServeHTTP(responseWriter, request.WithContext(ctx))
+			return
+		}
+
+		authorization := request.Header.Get("Authorization")
+		rawToken, found := strings.CutPrefix(authorization, "Bearer ")
+		rawToken = strings.TrimSpace(rawToken)
+
+		if !found || rawToken == "" {
+			responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="dsw"`)
+			serverHandler.Server.respondError(responseWriter, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		tokenName, token, valid := serverHandler.Server.currentConfiguration().AuthenticateToken(rawToken)
+		if !valid {
+			responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="dsw", error="invalid_token"`)
+			serverHandler.Server.respondError(responseWriter, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(request.Context(), tokenNameContextKey, tokenName)
+		ctx = context.WithValue(ctx, tokenScopesContextKey, token.Scopes)
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+	})
+}
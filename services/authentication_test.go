@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const testRawToken = "dsw_test-token"
+
+func newTestServerHandler(configuration *Configuration) *ServerHandler {
+	server := &Server{rateLimiter: NewRateLimiter()}
+	server.configuration.Store(configuration)
+	return &ServerHandler{Server: server}
+}
+
+func newTestConfiguration(scopes ...string) *Configuration {
+	configuration := NewConfiguration()
+	configuration.Tokens["ci"] = models.Token{Hash: HashToken(testRawToken), Scopes: scopes}
+	return configuration
+}
+
+func TestGenerateToken(t *testing.T) {
+	tokenPattern := regexp.MustCompile(`^dsw_[0-9a-f]{64}$`)
+
+	first, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, token := range []string{first, second} {
+		if !tokenPattern.MatchString(token) {
+			t.Fatalf("token %q does not match %s", token, tokenPattern)
+		}
+	}
+
+	if first == second {
+		t.Fatal("expected two generated tokens to differ")
+	}
+
+	if HashToken(first) != HashToken(first) || HashToken(first) == HashToken(second) {
+		t.Fatal("expected hashes to be stable and distinct per token")
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		err    string
+	}{
+		{name: "no scopes"},
+		{name: "names and globs", scopes: []string{"backup", "deploy-*", "logs-?", ":metrics"}},
+		{name: "empty scope", scopes: []string{"backup", ""}, err: "scope cannot be empty"},
+		{name: "malformed pattern", scopes: []string{"deploy-["}, err: `invalid scope pattern "deploy-["`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateScopes(test.scopes)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestIsActionInScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		actionName string
+		expected   bool
+	}{
+		{name: "unscoped token", actionName: "backup", expected: true},
+		{name: "exact name", scopes: []string{"backup"}, actionName: "backup", expected: true},
+		{name: "other name", scopes: []string{"backup"}, actionName: "backup-db", expected: false},
+		{name: "star glob", scopes: []string{"deploy-*"}, actionName: "deploy-web", expected: true},
+		{name: "star glob without prefix", scopes: []string{"deploy-*"}, actionName: "redeploy-web", expected: false},
+		{name: "question mark glob", scopes: []string{"logs-?"}, actionName: "logs-1", expected: true},
+		{name: "any of several scopes", scopes: []string{"backup", "deploy-*"}, actionName: "deploy-api", expected: true},
+		{name: "metrics scope", scopes: []string{metricsScope}, actionName: "metrics", expected: false},
+		{name: "malformed pattern", scopes: []string{"deploy-["}, actionName: "deploy-[", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := isActionInScope(test.scopes, test.actionName); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		local         bool
+		expected      int
+		tokenName     string
+	}{
+		{name: "missing header", expected: http.StatusUnauthorized},
+		{name: "wrong scheme", authorization: "Basic " + testRawToken, expected: http.StatusUnauthorized},
+		{name: "empty token", authorization: "Bearer  ", expected: http.StatusUnauthorized},
+		{name: "unknown token", authorization: "Bearer dsw_other", expected: http.StatusUnauthorized},
+		{name: "valid token", authorization: "Bearer " + testRawToken, expected: http.StatusOK, tokenName: "ci"},
+		{name: "unix socket", local: true, expected: http.StatusOK, tokenName: localCallerName},
+	}
+
+	serverHandler := newTestServerHandler(newTestConfiguration("backup"))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tokenName string
+			handler := serverHandler.authenticate(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				tokenName = tokenNameFromContext(request.Context())
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/actions", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			if test.local {
+				request = request.WithContext(context.WithValue(request.Context(), localConnectionContextKey, true))
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expected {
+				t.Fatalf("expected status %d, got %d", test.expected, recorder.Code)
+			}
+
+			if test.expected == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("expected a WWW-Authenticate header")
+			}
+
+			if tokenName != test.tokenName {
+				t.Fatalf("expected token name %q, got %q", test.tokenName, tokenName)
+			}
+		})
+	}
+}
+
+func TestAuthorizeMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   []string
+		expected int
+	}{
+		{name: "unscoped token", expected: http.StatusOK},
+		{name: "metrics scope", scopes: []string{"backup", metricsScope}, expected: http.StatusOK},
+		{name: "action scopes only", scopes: []string{"*"}, expected: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serverHandler := newTestServerHandler(newTestConfiguration(test.scopes...))
+			handler := serverHandler.authenticate(serverHandler.authorizeMetrics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			request.Header.Set("Authorization", "Bearer "+testRawToken)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expected {
+				t.Fatalf("expected status %d, got %d", test.expected, recorder.Code)
+			}
+		})
+	}
+}
@@ -18,7 +18,7 @@ Wants=network-online.target
 
 [Service]
 Type=simple
-ExecStart=%s serve -p %d
+ExecStart=%s serve
 Restart=on-failure
 RestartSec=10
 Environment="PATH=%s"
@@ -68,7 +68,7 @@ func (bootManager *BootManager) runSystemctl(args ...string) error {
 	return nil
 }
 
-func (bootManager *BootManager) EnableBootService(port int) error {
+func (bootManager *BootManager) EnableBootService() error {
 	execPath, err := bootManager.getExecutablePath()
 	if err != nil {
 		return fmt.Errorf("failed to get executable path: %w", err)
@@ -86,7 +86,6 @@ func (bootManager *BootManager) EnableBootService(port int) error {
 
 	serviceContent := fmt.Sprintf(serviceTemplate,
 		execPath,
-		port,
 		pathEnv,
 		home,
 	)
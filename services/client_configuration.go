@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/albertoboccolini/dsw/models"
+	"gopkg.in/yaml.v3"
+)
+
+type ClientConfiguration struct {
+	Profiles map[string]models.RemoteProfile `yaml:"profiles"`
+}
+
+func NewClientConfiguration() *ClientConfiguration {
+	return &ClientConfiguration{
+		Profiles: make(map[string]models.RemoteProfile),
+	}
+}
+
+func (clientConfiguration *ClientConfiguration) GetClientConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	configDir := filepath.Join(homeDir, ".dsw")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create configuration directory: %w", err)
+	}
+
+	return filepath.Join(configDir, "client.yaml"), nil
+}
+
+func (clientConfiguration *ClientConfiguration) Load() error {
+	configPath, err := clientConfiguration.GetClientConfigPath()
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read client configuration: %w", err)
+	}
+
+	if err := yaml.Unmarshal(yamlData, clientConfiguration); err != nil {
+		return fmt.Errorf("failed to unmarshal client configuration: %w", err)
+	}
+
+	if clientConfiguration.Profiles == nil {
+		clientConfiguration.Profiles = make(map[string]models.RemoteProfile)
+	}
+
+	return nil
+}
+
+func (clientConfiguration *ClientConfiguration) Save() error {
+	configPath, err := clientConfiguration.GetClientConfigPath()
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(clientConfiguration)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client configuration: %w", err)
+	}
+
+	tempPath := configPath + ".tmp"
+	if err := os.WriteFile(tempPath, yamlData, 0600); err != nil {
+		return fmt.Errorf("failed to write client configuration: %w", err)
+	}
+
+	if err := os.Rename(tempPath, configPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename client configuration: %w", err)
+	}
+
+	return nil
+}
+
+func (clientConfiguration *ClientConfiguration) AddProfile(name string, profile models.RemoteProfile) error {
+	if !actionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name: use only letters, numbers, dash and underscore")
+	}
+
+	if err := ValidateRemoteURL(profile.URL); err != nil {
+		return err
+	}
+
+	if _, err := ClientTLSConfig(profile); err != nil {
+		return err
+	}
+
+	clientConfiguration.Profiles[name] = profile
+	return nil
+}
+
+func (clientConfiguration *ClientConfiguration) GetProfile(name string) (models.RemoteProfile, bool) {
+	profile, exists := clientConfiguration.Profiles[name]
+	return profile, exists
+}
+
+func (clientConfiguration *ClientConfiguration) RemoveProfile(name string) error {
+	if _, exists := clientConfiguration.Profiles[name]; !exists {
+		return fmt.Errorf("profile not found: %s", name)
+	}
+
+	delete(clientConfiguration.Profiles, name)
+	return nil
+}
+
+func (clientConfiguration *ClientConfiguration) ListProfiles() map[string]models.RemoteProfile {
+	return maps.Clone(clientConfiguration.Profiles)
+}
+
+func ValidateRemoteURL(remoteURL string) error {
+	parsedURL, err := url.Parse(remoteURL)
+	if err != nil {
+		return fmt.Errorf("invalid remote URL: %w", err)
+	}
+
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("invalid remote URL: %s (expected http://host:port or https://host:port)", remoteURL)
+	}
+
+	return nil
+}
+
+// ResolveRemoteClient returns nil when neither -remote nor -profile is given,
+// meaning the command runs against the local configuration.
+func ResolveRemoteClient(remoteURL string, token string, profileName string) (*ApiClient, error) {
+	var profile models.RemoteProfile
+	if profileName != "" {
+		clientConfiguration := NewClientConfiguration()
+		if err := clientConfiguration.Load(); err != nil {
+			return nil, err
+		}
+
+		var exists bool
+		profile, exists = clientConfiguration.GetProfile(profileName)
+		if !exists {
+			return nil, fmt.Errorf("profile not found: %s", profileName)
+		}
+
+		if remoteURL == "" {
+			remoteURL = profile.URL
+		}
+		if token == "" {
+			token = profile.Token
+		}
+	}
+
+	if remoteURL == "" {
+		return nil, nil
+	}
+
+	if err := ValidateRemoteURL(remoteURL); err != nil {
+		return nil, err
+	}
+
+	if token == "" {
+		token = os.Getenv("DSW_TOKEN")
+	}
+
+	apiClient := NewApiClient(remoteURL, token)
+
+	tlsConfig, err := ClientTLSConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		apiClient.SetTLSConfig(tlsConfig)
+	}
+
+	return apiClient, nil
+}
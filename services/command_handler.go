@@ -1,39 +1,63 @@
 package services
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/albertoboccolini/dsw/models"
-	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 type CommandHandler struct {
 	configuration *Configuration
 	validator     *Validator
 	daemon        *Daemon
+	arguments     []string
 }
 
-func NewCommandHandler(configuration *Configuration, validator *Validator, daemon *Daemon) *CommandHandler {
+func NewCommandHandler(configuration *Configuration, validator *Validator, daemon *Daemon, arguments []string) *CommandHandler {
 	return &CommandHandler{
 		configuration: configuration,
 		validator:     validator,
 		daemon:        daemon,
+		arguments:     arguments,
 	}
 }
 
-func (commandHandler *CommandHandler) singleCreate(actionName, commandString string) {
+func (commandHandler *CommandHandler) singleCreate(actionName, commandString string, options models.Action, force bool) {
+	if _, exists := commandHandler.configuration.GetAction(actionName); exists && !force {
+		fmt.Fprintf(os.Stderr, "Error: action already exists: %s (use -force to overwrite)\n", actionName)
+		os.Exit(1)
+	}
+
 	command, args, err := commandHandler.validator.ParseCommandString(commandString)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: invalid command: %v\n", err)
 		os.Exit(1)
 	}
 
-	action := models.Action{
-		Command: command,
-		Args:    args,
+	action := options
+	action.Command = command
+	action.Args = args
+
+	if err := commandHandler.validator.ValidateAction(action); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid action: %v\n", err)
+		os.Exit(1)
 	}
 
 	if err := commandHandler.configuration.AddAction(actionName, action); err != nil {
@@ -49,27 +73,60 @@ func (commandHandler *CommandHandler) singleCreate(actionName, commandString str
 	fmt.Printf("Action '%s' created successfully\n", actionName)
 	fmt.Printf("  Command: %s\n", command)
 	fmt.Printf("  Args: %v\n", args)
-}
-
-func (commandHandler *CommandHandler) batchCreate(filePath string) {
-	yamlConfig := viper.New()
-	yamlConfig.SetConfigFile(filePath)
-	yamlConfig.SetConfigType("yaml")
-
-	if err := yamlConfig.ReadInConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to read configuration file: %v\n", err)
-		os.Exit(1)
+	if action.UsesShell() {
+		fmt.Println("  Shell: sh -c")
+	}
+	if action.Timeout > 0 {
+		fmt.Printf("  Timeout: %s\n", action.Timeout)
+	}
+	if action.WorkDir != "" {
+		fmt.Printf("  Workdir: %s\n", action.WorkDir)
+	}
+	if action.Cooldown > 0 {
+		fmt.Printf("  Cooldown: %s\n", action.Cooldown)
 	}
+	if action.IsExclusive() {
+		fmt.Printf("  Concurrency: %s\n", action.Concurrency)
+	}
+	if action.Retry != nil {
+		fmt.Printf("  Retry: %s\n", describeRetry(*action.Retry))
+	}
+	if len(action.Env) > 0 {
+		fmt.Printf("  Env: %s\n", strings.Join(sortedKeys(action.Env), ", "))
+	}
+}
 
-	var batchConfig Configuration
-	if err := yamlConfig.Unmarshal(&batchConfig); err != nil {
+func (commandHandler *CommandHandler) batchCreate(filePath string, force bool) {
+	batchConfig := NewConfiguration()
+	if err := batchConfig.LoadFromFile(filePath); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to parse configuration file: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Workflows go last, so that they can refer to actions from the same file.
+	actionNames := sortedKeys(batchConfig.Actions)
+	sort.SliceStable(actionNames, func(i, j int) bool {
+		return !batchConfig.Actions[actionNames[i]].IsWorkflow() && batchConfig.Actions[actionNames[j]].IsWorkflow()
+	})
+
 	addedCount := 0
-	for name, action := range batchConfig.Actions {
-		if err := commandHandler.validator.ValidateCommand(action.Command); err != nil {
+	for _, name := range actionNames {
+		action := batchConfig.Actions[name]
+		if _, exists := commandHandler.configuration.GetAction(name); exists && !force {
+			fmt.Fprintf(os.Stderr, "Warning: skipping action '%s': already exists (use -force to overwrite)\n", name)
+			continue
+		}
+
+		if action.Shell == nil && !action.IsWorkflow() {
+			action.Shell = new(bool)
+		}
+
+		if err := commandHandler.validator.ValidateAction(action); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping action '%s': %v\n", name, err)
+			continue
+		}
+
+		if err := commandHandler.validator.ValidateWorkflowActions(action, commandHandler.configuration.ListActions()); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: skipping action '%s': %v\n", name, err)
 			continue
 		}
@@ -81,42 +138,248 @@ func (commandHandler *CommandHandler) batchCreate(filePath string) {
 		addedCount++
 	}
 
+	addedTriggerCount := 0
+	for name, trigger := range batchConfig.Triggers {
+		action, exists := commandHandler.configuration.GetAction(trigger.Action)
+		if !exists {
+			fmt.Fprintf(os.Stderr, "Warning: skipping trigger '%s': action not found: %s\n", name, trigger.Action)
+			continue
+		}
+
+		if err := commandHandler.validator.ValidateTrigger(trigger, action); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping trigger '%s': %v\n", name, err)
+			continue
+		}
+
+		if err := commandHandler.configuration.AddTrigger(name, trigger); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to add trigger '%s': %v\n", name, err)
+			continue
+		}
+		addedTriggerCount++
+	}
+
 	if err := commandHandler.configuration.Save(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Printf("Added %d action(s) from %s\n", addedCount, filePath)
+	if addedTriggerCount > 0 {
+		fmt.Printf("Added %d trigger(s) from %s\n", addedTriggerCount, filePath)
+	}
 }
 
 func (commandHandler *CommandHandler) Create() {
 	createFlags := flag.NewFlagSet("create", flag.ExitOnError)
 	configFile := createFlags.String("f", "", "YAML file with actions to add")
-	createFlags.Parse(os.Args[2:])
+	timeout := createFlags.Duration("timeout", 0, "Maximum run time (e.g. 30m, default 60s)")
+	workDir := createFlags.String("workdir", "", "Working directory for the command")
+	useShell := createFlags.Bool("shell", false, "Run the command through sh -c (for pipelines and redirections)")
+	cooldown := createFlags.Duration("cooldown", 0, "Minimum time between runs triggered over HTTP (e.g. 10s)")
+	concurrency := createFlags.String("concurrency", "", "What to do when the action is already running: allow, reject, queue or replace (default allow)")
+	retryAttempts := createFlags.Int("retry", 0, "Maximum attempts, retrying failed runs")
+	retryDelay := createFlags.Duration("retry-delay", 0, "Delay before the first retry (default 1s)")
+	retryBackoff := createFlags.String("retry-backoff", "", "Backoff between retries: fixed or exponential (default fixed)")
+	force := createFlags.Bool("force", false, "Overwrite existing actions")
+	environment := keyValueFlag{}
+	createFlags.Var(environment, "env", "Environment variable KEY=VALUE (repeatable)")
+	createFlags.Parse(commandHandler.arguments[1:])
 
 	if *configFile != "" {
-		commandHandler.batchCreate(*configFile)
+		commandHandler.batchCreate(*configFile, *force)
 		return
 	}
 
 	if createFlags.NArg() < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: dsw create <name> <command>")
+		fmt.Fprintln(os.Stderr, "Usage: dsw create [-force] [-shell] [-timeout 30m] [-workdir dir] [-env KEY=VALUE] [-cooldown 10s] [-concurrency policy] [-retry n] [-retry-delay 1s] [-retry-backoff fixed|exponential] <name> <command>")
 		os.Exit(1)
 	}
 
 	actionName := createFlags.Arg(0)
 	commandString := createFlags.Arg(1)
 
-	commandHandler.singleCreate(actionName, commandString)
+	options := models.Action{
+		Shell:       useShell,
+		Timeout:     *timeout,
+		WorkDir:     *workDir,
+		Cooldown:    *cooldown,
+		Concurrency: models.ConcurrencyPolicy(*concurrency),
+	}
+	if len(environment) > 0 {
+		options.Env = environment
+	}
+
+	if *retryAttempts > 0 {
+		options.Retry = &models.RetryPolicy{
+			Attempts: *retryAttempts,
+			Delay:    *retryDelay,
+			Backoff:  models.BackoffStrategy(*retryBackoff),
+		}
+	} else if *retryDelay != 0 || *retryBackoff != "" {
+		fmt.Fprintln(os.Stderr, "Error: -retry-delay and -retry-backoff require -retry")
+		os.Exit(1)
+	}
+
+	commandHandler.singleCreate(actionName, commandString, options, *force)
+}
+
+type serverFlags struct {
+	port        *int
+	listen      *string
+	tlsCert     *string
+	tlsKey      *string
+	clientCA    *string
+	localCert   *string
+	localKey    *string
+	socket      *bool
+	maxParallel *int
+}
+
+func addServerFlags(flagSet *flag.FlagSet) serverFlags {
+	return serverFlags{
+		port:        flagSet.Int("p", 0, "Port to listen on, keeping the configured host (default 8080)"),
+		listen:      flagSet.String("listen", "", "Address to listen on as host:port, e.g. 127.0.0.1:8080 or [::1]:8080 (default 0.0.0.0:8080)"),
+		tlsCert:     flagSet.String("tls-cert", "", "TLS certificate file (PEM)"),
+		tlsKey:      flagSet.String("tls-key", "", "TLS private key file (PEM)"),
+		clientCA:    flagSet.String("client-ca", "", "CA bundle (PEM) for verifying client certificates (mutual TLS)"),
+		localCert:   flagSet.String("local-cert", "", "Client certificate (PEM) that local commands present with -client-ca"),
+		localKey:    flagSet.String("local-key", "", "Client private key (PEM) that local commands present with -client-ca"),
+		socket:      flagSet.Bool("socket", false, "Also listen on the Unix socket ~/.dsw/dsw.sock (use -listen none for the socket only)"),
+		maxParallel: flagSet.Int("max-parallel", 0, "Maximum executions running at once, queuing the rest (0 for no limit)"),
+	}
+}
+
+// applyServerFlags merges the flags given on the command line into the
+// configured server settings and saves them, so the daemon and the boot
+// service start with the same settings.
+func (commandHandler *CommandHandler) applyServerFlags(flagSet *flag.FlagSet, flags serverFlags) {
+	settings := commandHandler.configuration.GetServerSettings()
+	changed := false
+
+	flagSet.Visit(func(givenFlag *flag.Flag) {
+		switch givenFlag.Name {
+		case "p":
+			changed = true
+		case "listen":
+			settings.Listen = *flags.listen
+			changed = true
+		case "tls-cert":
+			settings.TLSCert = absolutePath(*flags.tlsCert)
+			changed = true
+		case "tls-key":
+			settings.TLSKey = absolutePath(*flags.tlsKey)
+			changed = true
+		case "client-ca":
+			settings.ClientCA = absolutePath(*flags.clientCA)
+			changed = true
+		case "local-cert":
+			settings.LocalCert = absolutePath(*flags.localCert)
+			changed = true
+		case "local-key":
+			settings.LocalKey = absolutePath(*flags.localKey)
+			changed = true
+		case "socket":
+			settings.Socket = *flags.socket
+			changed = true
+		case "max-parallel":
+			settings.MaxParallel = *flags.maxParallel
+			changed = true
+		}
+	})
+
+	if *flags.port > 0 && *flags.listen == "" {
+		host, _, err := net.SplitHostPort(listenAddressOf(settings))
+		if err != nil {
+			host = "0.0.0.0"
+		}
+		settings.Listen = net.JoinHostPort(host, strconv.Itoa(*flags.port))
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := commandHandler.validator.ValidateServerSettings(settings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid server settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	commandHandler.configuration.SetServerSettings(settings)
+	if err := commandHandler.configuration.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func absolutePath(filePath string) string {
+	if filePath == "" {
+		return ""
+	}
+
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return filePath
+	}
+
+	return absolutePath
+}
+
+// localApiClient prefers the Unix socket when the server exposes one, since
+// it needs neither a token nor a client certificate.
+func (commandHandler *CommandHandler) localApiClient(port int, token string) *ApiClient {
+	if port == 0 {
+		if socketPath, found := commandHandler.localSocketPath(); found {
+			return NewSocketApiClient(socketPath)
+		}
+	}
+
+	settings := commandHandler.configuration.GetServerSettings()
+	apiClient := NewApiClient(localBaseURL(settings, port), token)
+
+	tlsConfig, err := LocalClientTLSConfig(settings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if tlsConfig != nil {
+		apiClient.SetTLSConfig(tlsConfig)
+	}
+
+	return apiClient
+}
+
+func (commandHandler *CommandHandler) localSocketPath() (string, bool) {
+	socketPath, err := commandHandler.configuration.GetSocketPath()
+	if err != nil {
+		return "", false
+	}
+
+	fileInfo, err := os.Stat(socketPath)
+	if err != nil || fileInfo.Mode()&os.ModeSocket == 0 {
+		return "", false
+	}
+
+	return socketPath, true
 }
 
 func (commandHandler *CommandHandler) Serve() {
 	serveFlags := flag.NewFlagSet("serve", flag.ExitOnError)
-	port := serveFlags.Int("p", 8080, "Port to listen on")
+	flags := addServerFlags(serveFlags)
 	daemonMode := serveFlags.Bool("d", false, "Run in daemon mode")
-	serveFlags.Parse(os.Args[2:])
+	serveFlags.Parse(commandHandler.arguments[1:])
+
+	commandHandler.applyServerFlags(serveFlags, flags)
+
+	// The server only starts with a configuration it would accept on reload,
+	// and the daemon is checked before it detaches. Saved actions count as
+	// unchanged, so a missing command is only logged.
+	if err := commandHandler.validator.ValidateConfiguration(commandHandler.configuration, commandHandler.configuration); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *daemonMode {
-		if err := commandHandler.daemon.StartDaemon(*port); err != nil {
+		if err := commandHandler.daemon.StartDaemon(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -127,7 +390,16 @@ func (commandHandler *CommandHandler) Serve() {
 		slog.Warn("no actions configured")
 	}
 
-	serverHandler := NewServerHandler(commandHandler.configuration, *port)
+	if len(commandHandler.configuration.Tokens) == 0 && commandHandler.configuration.GetServerSettings().Listen != listenDisabled {
+		slog.Warn("no API tokens configured, TCP requests will be rejected", "hint", "dsw token create <name>")
+	}
+
+	serverHandler, err := NewServerHandler(commandHandler.configuration)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	if err := serverHandler.Server.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: server failed: %v\n", err)
 		os.Exit(1)
@@ -141,22 +413,59 @@ func (commandHandler *CommandHandler) ServerStop() {
 	}
 }
 
+func (commandHandler *CommandHandler) Status() {
+	statusFlags := flag.NewFlagSet("status", flag.ExitOnError)
+	port := statusFlags.Int("p", 0, "Port the server listens on (defaults to the configured one)")
+	statusFlags.Parse(commandHandler.arguments[1:])
+
+	if pid, running := commandHandler.daemon.RunningPID(); running {
+		fmt.Printf("Daemon:   running (PID %d)\n", pid)
+	} else {
+		fmt.Println("Daemon:   not running")
+	}
+
+	bootState := "disabled"
+	if NewBootManager(commandHandler.configuration).IsBootServiceEnabled() {
+		bootState = "enabled"
+	}
+
+	// The probe may go through the socket, so the TCP address is shown too.
+	listenAddress := describeListenAddress(commandHandler.configuration.GetServerSettings(), *port)
+
+	apiClient := commandHandler.localApiClient(*port, "")
+	health, err := apiClient.Health()
+	if err != nil {
+		fmt.Printf("Server:   not responding at %s\n", apiClient.BaseURL())
+		fmt.Printf("Listen:   %s\n", listenAddress)
+		fmt.Printf("Boot:     %s\n", bootState)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Server:   %s at %s (v%s)\n", health.Status, apiClient.BaseURL(), health.Version)
+	fmt.Printf("Listen:   %s\n", listenAddress)
+	printHealth(health)
+	fmt.Printf("Boot:     %s\n", bootState)
+}
+
 func (commandHandler *CommandHandler) HandleBoot() {
-	if len(os.Args) < 3 {
+	if len(commandHandler.arguments) < 2 {
 		fmt.Fprintln(os.Stderr, "Error: boot subcommand required (enable|disable)")
 		os.Exit(1)
 	}
 
-	bootCommand := os.Args[2]
+	bootCommand := commandHandler.arguments[1]
 	bootManager := NewBootManager(commandHandler.configuration)
 
 	switch bootCommand {
 	case "enable":
 		bootFlags := flag.NewFlagSet("boot enable", flag.ExitOnError)
-		port := bootFlags.Int("p", 8080, "Port to listen on")
-		bootFlags.Parse(os.Args[3:])
+		flags := addServerFlags(bootFlags)
+		bootFlags.Parse(commandHandler.arguments[2:])
 
-		if err := bootManager.EnableBootService(*port); err != nil {
+		commandHandler.applyServerFlags(bootFlags, flags)
+
+		if err := bootManager.EnableBootService(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -172,3 +481,794 @@ func (commandHandler *CommandHandler) HandleBoot() {
 		os.Exit(1)
 	}
 }
+
+func (commandHandler *CommandHandler) HandleToken() {
+	if len(commandHandler.arguments) < 2 {
+		fmt.Fprintln(os.Stderr, "Error: token subcommand required (create|list|revoke)")
+		os.Exit(1)
+	}
+
+	tokenCommand := commandHandler.arguments[1]
+
+	switch tokenCommand {
+	case "create":
+		tokenFlags := flag.NewFlagSet("token create", flag.ExitOnError)
+		scopeList := tokenFlags.String("scope", "", "Comma-separated action names or glob patterns the token may run")
+		tokenFlags.Parse(commandHandler.arguments[2:])
+
+		if tokenFlags.NArg() < 1 {
+			fmt.Fprintln(os.Stderr, "Usage: dsw token create [-scope <patterns>] <name>")
+			os.Exit(1)
+		}
+
+		// Flags after the name are honoured too, so that a misplaced -scope
+		// never creates a token with full access.
+		tokenName := tokenFlags.Arg(0)
+		tokenFlags.Parse(tokenFlags.Args()[1:])
+		if tokenFlags.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "Error: unexpected arguments: %s\n", strings.Join(tokenFlags.Args(), " "))
+			os.Exit(1)
+		}
+		commandHandler.createToken(tokenName, splitScopes(*scopeList))
+
+	case "list":
+		commandHandler.listTokens()
+
+	case "revoke":
+		if len(commandHandler.arguments) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: dsw token revoke <name>")
+			os.Exit(1)
+		}
+		commandHandler.revokeToken(commandHandler.arguments[2])
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown token command: %s\n", tokenCommand)
+		os.Exit(1)
+	}
+}
+
+func splitScopes(scopeList string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(scopeList, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+func (commandHandler *CommandHandler) createToken(tokenName string, scopes []string) {
+	rawToken, err := GenerateToken()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	token := models.Token{
+		Hash:      HashToken(rawToken),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Scopes:    scopes,
+	}
+
+	if err := commandHandler.configuration.AddToken(tokenName, token); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to add token: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := commandHandler.configuration.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Token '%s' created successfully\n", tokenName)
+	if len(scopes) > 0 {
+		fmt.Printf("  Scopes: %s\n", strings.Join(scopes, ", "))
+	}
+	fmt.Println("Store it now, it will not be shown again:")
+	fmt.Println(rawToken)
+}
+
+func (commandHandler *CommandHandler) listTokens() {
+	if len(commandHandler.configuration.Tokens) == 0 {
+		fmt.Println("No tokens configured")
+		return
+	}
+
+	for _, name := range sortedKeys(commandHandler.configuration.Tokens) {
+		token := commandHandler.configuration.Tokens[name]
+		scopes := "*"
+		if len(token.Scopes) > 0 {
+			scopes = strings.Join(token.Scopes, ",")
+		}
+		fmt.Printf("%s\tcreated %s\tscopes %s\n", name, token.CreatedAt, scopes)
+	}
+}
+
+func (commandHandler *CommandHandler) revokeToken(tokenName string) {
+	if err := commandHandler.configuration.RevokeToken(tokenName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := commandHandler.configuration.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Token '%s' revoked successfully\n", tokenName)
+}
+
+func (commandHandler *CommandHandler) Cancel() {
+	cancelFlags := flag.NewFlagSet("cancel", flag.ExitOnError)
+	port := cancelFlags.Int("p", 0, "Port the server listens on (defaults to the configured one)")
+	token := cancelFlags.String("t", os.Getenv("DSW_TOKEN"), "API token (defaults to $DSW_TOKEN)")
+	cancelFlags.Parse(commandHandler.arguments[1:])
+
+	if cancelFlags.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw cancel [-p 8080] [-t token] <job-id>")
+		os.Exit(1)
+	}
+
+	jobID := cancelFlags.Arg(0)
+	apiClient := commandHandler.localApiClient(*port, *token)
+
+	job, err := apiClient.CancelJob(jobID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to cancel job: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Cancellation requested for job '%s' (action '%s')\n", job.ID, job.Action)
+}
+
+func (commandHandler *CommandHandler) Jobs() {
+	jobsFlags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	port := jobsFlags.Int("p", 0, "Port the server listens on (defaults to the configured one)")
+	token := jobsFlags.String("t", os.Getenv("DSW_TOKEN"), "API token (defaults to $DSW_TOKEN)")
+	jsonOutput := jobsFlags.Bool("json", false, "Print jobs as JSON")
+	jobsFlags.Parse(commandHandler.arguments[1:])
+
+	apiClient := commandHandler.localApiClient(*port, *token)
+	printJobs(apiClient, jobsFlags.Arg(0), *jsonOutput)
+}
+
+func (commandHandler *CommandHandler) History() {
+	options := parseHistoryOptions(commandHandler.arguments[1:])
+
+	filter, err := options.filter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	historyPath, err := commandHandler.configuration.GetHistoryPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := NewHistoryStore(historyPath).Query(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	printHistory(entries, options.jsonOutput)
+}
+
+func (commandHandler *CommandHandler) HandleRemote() {
+	if len(commandHandler.arguments) < 2 {
+		fmt.Fprintln(os.Stderr, "Error: remote subcommand required (add|list|remove)")
+		os.Exit(1)
+	}
+
+	clientConfiguration := NewClientConfiguration()
+	if err := clientConfiguration.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	remoteCommand := commandHandler.arguments[1]
+
+	switch remoteCommand {
+	case "add":
+		remoteFlags := flag.NewFlagSet("remote add", flag.ExitOnError)
+		token := remoteFlags.String("t", "", "API token for the remote server (defaults to $DSW_TOKEN at run time)")
+		certificateAuthority := remoteFlags.String("ca", "", "CA bundle (PEM) to verify the server certificate")
+		clientCert := remoteFlags.String("cert", "", "Client certificate (PEM) for mutual TLS")
+		clientKey := remoteFlags.String("key", "", "Client private key (PEM) for mutual TLS")
+		remoteFlags.Parse(commandHandler.arguments[2:])
+
+		if remoteFlags.NArg() < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: dsw remote add [-t token] [-ca file] [-cert file -key file] <name> <url>")
+			os.Exit(1)
+		}
+
+		profileName := remoteFlags.Arg(0)
+		profile := models.RemoteProfile{
+			URL:        remoteFlags.Arg(1),
+			Token:      *token,
+			CA:         absolutePath(*certificateAuthority),
+			ClientCert: absolutePath(*clientCert),
+			ClientKey:  absolutePath(*clientKey),
+		}
+		if err := clientConfiguration.AddProfile(profileName, profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := clientConfiguration.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Remote '%s' saved (%s)\n", profileName, profile.URL)
+
+	case "list":
+		profiles := clientConfiguration.ListProfiles()
+		if len(profiles) == 0 {
+			fmt.Println("No remotes configured")
+			return
+		}
+
+		for _, name := range sortedKeys(profiles) {
+			tokenSource := "$DSW_TOKEN"
+			if profiles[name].Token != "" {
+				tokenSource = "stored"
+			}
+			fmt.Printf("%s\t%s\ttoken %s\n", name, profiles[name].URL, tokenSource)
+		}
+
+	case "remove":
+		if len(commandHandler.arguments) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: dsw remote remove <name>")
+			os.Exit(1)
+		}
+
+		profileName := commandHandler.arguments[2]
+		if err := clientConfiguration.RemoveProfile(profileName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := clientConfiguration.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Remote '%s' removed\n", profileName)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown remote command: %s\n", remoteCommand)
+		os.Exit(1)
+	}
+}
+
+func (commandHandler *CommandHandler) HandleSchedule() {
+	if len(commandHandler.arguments) < 2 || commandHandler.arguments[1] != "list" {
+		fmt.Fprintln(os.Stderr, "Usage: dsw schedule list [-p 8080] [-t token]")
+		os.Exit(1)
+	}
+
+	scheduleFlags := flag.NewFlagSet("schedule list", flag.ExitOnError)
+	port := scheduleFlags.Int("p", 0, "Port the server listens on (defaults to the configured one)")
+	token := scheduleFlags.String("t", os.Getenv("DSW_TOKEN"), "API token (defaults to $DSW_TOKEN)")
+	scheduleFlags.Parse(commandHandler.arguments[2:])
+
+	apiClient := commandHandler.localApiClient(*port, *token)
+
+	statuses, err := apiClient.ListSchedules()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Showing next runs computed from the configuration, last runs are unavailable")
+		statuses = PlanSchedules(commandHandler.configuration)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No schedules configured")
+		return
+	}
+
+	fmt.Printf("%-20s %-20s %-30s %-26s %s\n", "TRIGGER", "ACTION", "SCHEDULE", "NEXT RUN", "LAST RUN")
+	for _, status := range statuses {
+		fmt.Printf("%-20s %-20s %-30s %-26s %s\n",
+			status.Trigger,
+			status.Action,
+			status.Schedule,
+			formatOptionalTime(status.NextRun),
+			formatLastRun(status))
+	}
+}
+
+func formatOptionalTime(value *time.Time) string {
+	if value == nil {
+		return "-"
+	}
+
+	return value.Local().Format(time.RFC3339)
+}
+
+func formatLastRun(status models.ScheduleStatus) string {
+	if status.LastRun == nil {
+		return "-"
+	}
+
+	if status.LastState == "" {
+		return formatOptionalTime(status.LastRun)
+	}
+
+	return fmt.Sprintf("%s (%s)", formatOptionalTime(status.LastRun), status.LastState)
+}
+
+func (commandHandler *CommandHandler) List() {
+	listFlags := flag.NewFlagSet("list", flag.ExitOnError)
+	jsonOutput := listFlags.Bool("json", false, "Print actions as JSON")
+	listFlags.Parse(commandHandler.arguments[1:])
+
+	actions := commandHandler.configuration.ListActions()
+
+	if *jsonOutput {
+		printJSON(ActionsResponse{Actions: actions})
+		return
+	}
+
+	if len(actions) == 0 {
+		fmt.Println("No actions configured")
+		return
+	}
+
+	fmt.Printf("%-24s %-6s %-8s %s\n", "NAME", "SHELL", "TIMEOUT", "COMMAND")
+	for _, name := range sortedKeys(actions) {
+		action := actions[name]
+		fmt.Printf("%-24s %-6t %-8s %s\n", name, action.UsesShell() && !action.IsWorkflow(), describeTimeout(action), describeCommand(action))
+	}
+}
+
+func describeCommand(action models.Action) string {
+	if action.IsWorkflow() {
+		stepNames := make([]string, len(action.Workflow))
+		for index, step := range action.Workflow {
+			stepNames[index] = step.Name
+		}
+		return "workflow: " + strings.Join(stepNames, ", ")
+	}
+
+	return strings.TrimSpace(action.Command + " " + strings.Join(action.Args, " "))
+}
+
+func describeTimeout(action models.Action) string {
+	if timeout := timeoutOf(action); timeout > 0 {
+		return timeout.String()
+	}
+
+	return "-"
+}
+
+func (commandHandler *CommandHandler) Show() {
+	if len(commandHandler.arguments) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw show <name>")
+		os.Exit(1)
+	}
+
+	actionName := commandHandler.arguments[1]
+	action, exists := commandHandler.configuration.GetAction(actionName)
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: action not found: %s\n", actionName)
+		os.Exit(1)
+	}
+
+	yamlData, err := yaml.Marshal(map[string]models.Action{actionName: action})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to marshal action: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(string(yamlData))
+}
+
+func (commandHandler *CommandHandler) Delete() {
+	if len(commandHandler.arguments) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw delete <name>")
+		os.Exit(1)
+	}
+
+	actionName := commandHandler.arguments[1]
+	if err := commandHandler.configuration.RemoveAction(actionName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := commandHandler.configuration.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Action '%s' deleted successfully\n", actionName)
+}
+
+func (commandHandler *CommandHandler) Rename() {
+	if len(commandHandler.arguments) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw rename <old> <new>")
+		os.Exit(1)
+	}
+
+	oldName := commandHandler.arguments[1]
+	newName := commandHandler.arguments[2]
+	if err := commandHandler.configuration.RenameAction(oldName, newName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := commandHandler.configuration.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Action '%s' renamed to '%s'\n", oldName, newName)
+}
+
+func (commandHandler *CommandHandler) Edit() {
+	if len(commandHandler.arguments) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw edit <name>")
+		os.Exit(1)
+	}
+
+	actionName := commandHandler.arguments[1]
+	action, exists := commandHandler.configuration.GetAction(actionName)
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: action not found: %s\n", actionName)
+		os.Exit(1)
+	}
+
+	originalData, err := yaml.Marshal(action)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to marshal action: %v\n", err)
+		os.Exit(1)
+	}
+
+	tempFile, err := os.CreateTemp("", "dsw-"+actionName+"-*.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create temporary file: %v\n", err)
+		os.Exit(1)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer os.Remove(tempPath)
+
+	if err := os.WriteFile(tempPath, originalData, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write temporary file: %v\n", err)
+		os.Exit(1)
+	}
+
+	for {
+		if err := openEditor(tempPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		editedData, err := os.ReadFile(tempPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read edited action: %v\n", err)
+			os.Exit(1)
+		}
+
+		if bytes.Equal(editedData, originalData) {
+			fmt.Println("No changes")
+			return
+		}
+
+		editedAction, err := commandHandler.parseEditedAction(actionName, editedData)
+		if err == nil {
+			action = editedAction
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: invalid action: %v\n", err)
+		if !confirm("Edit again? [Y/n] ") {
+			fmt.Println("Changes discarded")
+			os.Exit(1)
+		}
+	}
+
+	if err := commandHandler.configuration.AddAction(actionName, action); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to update action: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := commandHandler.configuration.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Action '%s' updated successfully\n", actionName)
+}
+
+func (commandHandler *CommandHandler) parseEditedAction(actionName string, data []byte) (models.Action, error) {
+	var action models.Action
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&action); err != nil {
+		return models.Action{}, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	if err := commandHandler.validator.ValidateAction(action); err != nil {
+		return models.Action{}, err
+	}
+
+	actions := commandHandler.configuration.ListActions()
+	actions[normalizeActionName(actionName)] = action
+	if err := commandHandler.validator.ValidateWorkflows(actions); err != nil {
+		return models.Action{}, err
+	}
+
+	return action, nil
+}
+
+func openEditor(filePath string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	editorFields := strings.Fields(editor)
+	command := exec.Command(editorFields[0], append(editorFields[1:], filePath)...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+
+	return nil
+}
+
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// awaitConfigurationReload gives the server a moment to reload a
+// configuration saved after it last loaded one, so that running an action
+// right after creating or editing it does not hit the old configuration.
+func (commandHandler *CommandHandler) awaitConfigurationReload(apiClient *ApiClient) {
+	configPath, err := commandHandler.configuration.GetConfigPath()
+	if err != nil {
+		return
+	}
+
+	fileInfo, err := os.Stat(configPath)
+	if err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(configurationReloadWait)
+	for {
+		health, err := apiClient.Health()
+		if err != nil {
+			return
+		}
+
+		// A rejected reload also means the server has read the file.
+		handledAt := health.Configuration.LoadedAt
+		if lastReloadAt := health.Configuration.LastReloadAt; lastReloadAt != nil && lastReloadAt.After(handledAt) {
+			handledAt = *lastReloadAt
+		}
+
+		if !handledAt.Before(fileInfo.ModTime()) || time.Now().After(deadline) {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (commandHandler *CommandHandler) Run() {
+	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
+	parameterValues := keyValueFlag{}
+	runFlags.Var(parameterValues, "param", "Parameter value KEY=VALUE (repeatable)")
+	jsonOutput := runFlags.Bool("json", false, "Print the result as JSON instead of streaming output")
+	dryRun := runFlags.Bool("dry-run", false, "Print the command, environment and workdir without running it")
+	async := runFlags.Bool("async", false, "Submit the action to the local server and print the job without waiting")
+	local := runFlags.Bool("local", false, "Run in this process even when the local server socket is available")
+	runFlags.Parse(commandHandler.arguments[1:])
+
+	if runFlags.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw run <name> [-param KEY=VALUE]... [-json] [-async] [-dry-run] [-local]")
+		os.Exit(1)
+	}
+
+	actionName := runFlags.Arg(0)
+	runFlags.Parse(runFlags.Args()[1:])
+
+	if !*dryRun && !*local {
+		if socketPath, found := commandHandler.localSocketPath(); found {
+			apiClient := NewSocketApiClient(socketPath)
+			commandHandler.awaitConfigurationReload(apiClient)
+			runOnServer(apiClient, actionName, parameterValues, *jsonOutput, *async)
+			return
+		}
+	}
+
+	if *async {
+		fmt.Fprintln(os.Stderr, "Error: -async needs a local server listening on the Unix socket (dsw serve -socket)")
+		os.Exit(1)
+	}
+
+	action, exists := commandHandler.configuration.GetAction(actionName)
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: action not found: %s\n", actionName)
+		os.Exit(1)
+	}
+
+	parameters, err := commandHandler.validator.ValidateParameters(action, parameterValues)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	execution := Execution{
+		ActionName: actionName,
+		Action:     action,
+		Parameters: parameters,
+		Source:     SourceCLI,
+		Caller:     os.Getenv("USER"),
+	}
+	executor := NewExecutor(nil, commandHandler.validator, commandHandler.configuration.GetAction, nil)
+
+	if *dryRun {
+		printDryRun(executor, execution)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var listener OutputListener
+	if !*jsonOutput {
+		listener = func(stream string, line string) {
+			if stream == streamStderr {
+				fmt.Fprintln(os.Stderr, line)
+				return
+			}
+			fmt.Println(line)
+		}
+	}
+
+	startedAt := time.Now()
+	result := executor.ExecuteStreaming(ctx, execution, listener)
+	commandHandler.recordRun(execution, startedAt, result)
+
+	if *jsonOutput {
+		printJSON(result)
+	} else if !result.Success {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Message)
+	}
+
+	stop()
+	os.Exit(exitCodeOf(result))
+}
+
+func (commandHandler *CommandHandler) recordRun(execution Execution, startedAt time.Time, result models.ApiResponse) {
+	historyPath, err := commandHandler.configuration.GetHistoryPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %v\n", err)
+		return
+	}
+
+	finishedAt := time.Now()
+	job := models.Job{
+		ID:         generateJobID(),
+		Action:     execution.ActionName,
+		State:      jobStateFromResult(result),
+		CreatedAt:  startedAt,
+		StartedAt:  &startedAt,
+		FinishedAt: &finishedAt,
+		Result:     &result,
+	}
+
+	history := NewHistoryStore(historyPath)
+	entry := NewHistoryEntry(job, execution)
+	notifications := NewNotificationDispatcher(history, commandHandler.configuration.ListNotifiers)
+	notifications.Notify(entry)
+
+	if err := history.Append(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %v\n", err)
+	}
+
+	notifications.Wait()
+}
+
+func exitCodeOf(result models.ApiResponse) int {
+	if result.Success {
+		return 0
+	}
+
+	if result.ExitCode > 0 {
+		return result.ExitCode
+	}
+
+	return 1
+}
+
+func printDryRun(executor *Executor, execution Execution) {
+	if execution.Action.IsWorkflow() {
+		printWorkflowPlan(execution.Action)
+		return
+	}
+
+	command := executor.PrepareCommand(context.Background(), execution)
+
+	fmt.Println("Argv:")
+	for index, argument := range command.Args {
+		fmt.Printf("  [%d] %q\n", index, argument)
+	}
+
+	workDir := command.Dir
+	if workDir == "" {
+		workDir, _ = os.Getwd()
+		workDir += " (current directory)"
+	}
+	fmt.Printf("Workdir: %s\n", workDir)
+
+	fmt.Println("Environment (added to the current environment):")
+	environment := maps.Clone(execution.Action.Env)
+	if environment == nil {
+		environment = make(map[string]string)
+	}
+	maps.Copy(environment, execution.Environment)
+
+	if len(environment) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, name := range sortedKeys(environment) {
+		fmt.Printf("  %s=%s\n", name, environment[name])
+	}
+
+	fmt.Printf("Timeout: %s\n", timeoutOf(execution.Action))
+	if execution.Action.Retry != nil {
+		fmt.Printf("Retry: %s (timeout per attempt)\n", describeRetry(*execution.Action.Retry))
+	}
+}
+
+func printWorkflowPlan(action models.Action) {
+	fmt.Println("Workflow steps:")
+	for index, step := range action.Workflow {
+		onSuccess := step.OnSuccess
+		if onSuccess == "" {
+			onSuccess = models.WorkflowEnd
+			if index+1 < len(action.Workflow) {
+				onSuccess = action.Workflow[index+1].Name
+			}
+		}
+
+		onFailure := step.OnFailure
+		if onFailure == "" {
+			onFailure = models.WorkflowEnd
+		}
+
+		actions := strings.Join(step.Actions(), " + ")
+		fmt.Printf("  %d. %s: %s (on success: %s, on failure: %s)\n", index+1, step.Name, actions, onSuccess, onFailure)
+		if step.Timeout > 0 {
+			fmt.Printf("     timeout: %s\n", step.Timeout)
+		}
+		for _, name := range sortedKeys(step.Params) {
+			fmt.Printf("     %s=%s\n", name, step.Params[name])
+		}
+	}
+
+	fmt.Printf("Timeout: %s\n", describeTimeout(action))
+}
@@ -1,23 +1,36 @@
 package services
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/albertoboccolini/dsw/models"
-	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 )
 
 type Configuration struct {
-	Actions map[string]models.Action `yaml:"actions" mapstructure:"actions"`
+	mutex           sync.RWMutex
+	Actions         map[string]models.Action   `yaml:"actions"`
+	Tokens          map[string]models.Token    `yaml:"tokens"`
+	Triggers        map[string]models.Trigger  `yaml:"triggers"`
+	Server          models.ServerSettings      `yaml:"server,omitempty"`
+	ClientRateLimit *models.RateLimit          `yaml:"client_rate_limit,omitempty"`
+	Notifiers       map[string]models.Notifier `yaml:"notifiers,omitempty"`
 }
 
 func NewConfiguration() *Configuration {
 	return &Configuration{
-		Actions: make(map[string]models.Action),
+		Actions:  make(map[string]models.Action),
+		Tokens:   make(map[string]models.Token),
+		Triggers: make(map[string]models.Trigger),
 	}
 }
 
@@ -46,25 +59,49 @@ func (configuration *Configuration) GetPIDPath() (string, error) {
 	return filepath.Join(homeDir, ".dsw", "dsw.pid"), nil
 }
 
+func (configuration *Configuration) GetSocketPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".dsw", "dsw.sock"), nil
+}
+
+func (configuration *Configuration) GetHistoryPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".dsw", "history.jsonl"), nil
+}
+
 func (configuration *Configuration) Load() error {
 	configPath, err := configuration.GetConfigPath()
 	if err != nil {
 		return err
 	}
 
-	yamlConfig := viper.New()
-	yamlConfig.SetConfigFile(configPath)
-	yamlConfig.SetConfigType("yaml")
-
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return nil
 	}
 
-	if err := yamlConfig.ReadInConfig(); err != nil {
+	return configuration.LoadFromFile(configPath)
+}
+
+// LoadFromFile keeps map keys such as action names and environment variables
+// exactly as written, since both are case-sensitive.
+func (configuration *Configuration) LoadFromFile(filePath string) error {
+	yamlData, err := os.ReadFile(filePath)
+	if err != nil {
 		return fmt.Errorf("failed to read configuration: %w", err)
 	}
 
-	if err := yamlConfig.Unmarshal(&configuration); err != nil {
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	if err := yaml.Unmarshal(yamlData, configuration); err != nil {
 		return fmt.Errorf("failed to unmarshal configuration: %w", err)
 	}
 
@@ -72,6 +109,14 @@ func (configuration *Configuration) Load() error {
 		configuration.Actions = make(map[string]models.Action)
 	}
 
+	if configuration.Tokens == nil {
+		configuration.Tokens = make(map[string]models.Token)
+	}
+
+	if configuration.Triggers == nil {
+		configuration.Triggers = make(map[string]models.Trigger)
+	}
+
 	return nil
 }
 
@@ -81,11 +126,24 @@ func (configuration *Configuration) Save() error {
 		return err
 	}
 
+	configuration.mutex.RLock()
 	data := map[string]interface{}{
-		"actions": configuration.Actions,
+		"actions":  configuration.Actions,
+		"tokens":   configuration.Tokens,
+		"triggers": configuration.Triggers,
+	}
+	if configuration.Server != (models.ServerSettings{}) {
+		data["server"] = configuration.Server
+	}
+	if configuration.ClientRateLimit != nil {
+		data["client_rate_limit"] = configuration.ClientRateLimit
+	}
+	if len(configuration.Notifiers) > 0 {
+		data["notifiers"] = configuration.Notifiers
 	}
 
 	yamlData, err := yaml.Marshal(data)
+	configuration.mutex.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal configuration: %w", err)
 	}
@@ -110,16 +168,240 @@ func (configuration *Configuration) AddAction(name string, action models.Action)
 		return fmt.Errorf("invalid action name: use only letters, numbers, dash and underscore")
 	}
 
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
 	configuration.Actions[normalizedName] = action
 	return nil
 }
 
 func (configuration *Configuration) GetAction(name string) (models.Action, bool) {
 	normalizedName := normalizeActionName(name)
+
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
 	action, exists := configuration.Actions[normalizedName]
 	return action, exists
 }
 
+func (configuration *Configuration) RemoveAction(name string) error {
+	normalizedName := normalizeActionName(name)
+
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	if _, exists := configuration.Actions[normalizedName]; !exists {
+		return fmt.Errorf("action not found: %s", name)
+	}
+
+	if triggerNames := configuration.triggersOf(normalizedName); len(triggerNames) > 0 {
+		return fmt.Errorf("action '%s' is used by trigger(s): %s", name, strings.Join(triggerNames, ", "))
+	}
+
+	if workflowNames := configuration.workflowsOf(normalizedName); len(workflowNames) > 0 {
+		return fmt.Errorf("action '%s' is used by workflow(s): %s", name, strings.Join(workflowNames, ", "))
+	}
+
+	delete(configuration.Actions, normalizedName)
+	return nil
+}
+
+func (configuration *Configuration) RenameAction(oldName string, newName string) error {
+	normalizedOldName := normalizeActionName(oldName)
+	normalizedNewName := normalizeActionName(newName)
+
+	if !isValidActionName(normalizedNewName) {
+		return fmt.Errorf("invalid action name: use only letters, numbers, dash and underscore")
+	}
+
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	action, exists := configuration.Actions[normalizedOldName]
+	if !exists {
+		return fmt.Errorf("action not found: %s", oldName)
+	}
+
+	if _, exists := configuration.Actions[normalizedNewName]; exists {
+		return fmt.Errorf("action already exists: %s", newName)
+	}
+
+	delete(configuration.Actions, normalizedOldName)
+	configuration.Actions[normalizedNewName] = action
+
+	for _, triggerName := range configuration.triggersOf(normalizedOldName) {
+		trigger := configuration.Triggers[triggerName]
+		trigger.Action = normalizedNewName
+		configuration.Triggers[triggerName] = trigger
+	}
+
+	for _, workflowName := range configuration.workflowsOf(normalizedOldName) {
+		workflow := configuration.Actions[workflowName]
+		workflow.Workflow = slices.Clone(workflow.Workflow)
+		for index, step := range workflow.Workflow {
+			if step.Action == normalizedOldName {
+				step.Action = normalizedNewName
+			}
+			if parallelIndex := slices.Index(step.Parallel, normalizedOldName); parallelIndex >= 0 {
+				step.Parallel = slices.Clone(step.Parallel)
+				step.Parallel[parallelIndex] = normalizedNewName
+			}
+			workflow.Workflow[index] = step
+		}
+		configuration.Actions[workflowName] = workflow
+	}
+
+	for tokenName, token := range configuration.Tokens {
+		if index := slices.Index(token.Scopes, normalizedOldName); index >= 0 {
+			token.Scopes = slices.Clone(token.Scopes)
+			token.Scopes[index] = normalizedNewName
+			configuration.Tokens[tokenName] = token
+		}
+	}
+
+	return nil
+}
+
+func (configuration *Configuration) triggersOf(actionName string) []string {
+	var triggerNames []string
+	for triggerName, trigger := range configuration.Triggers {
+		if trigger.Action == actionName {
+			triggerNames = append(triggerNames, triggerName)
+		}
+	}
+	sort.Strings(triggerNames)
+
+	return triggerNames
+}
+
+func (configuration *Configuration) workflowsOf(actionName string) []string {
+	var workflowNames []string
+	for workflowName, workflow := range configuration.Actions {
+		for _, step := range workflow.Workflow {
+			if slices.Contains(step.Actions(), actionName) {
+				workflowNames = append(workflowNames, workflowName)
+				break
+			}
+		}
+	}
+	sort.Strings(workflowNames)
+
+	return workflowNames
+}
+
+func (configuration *Configuration) ListActions() map[string]models.Action {
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	return maps.Clone(configuration.Actions)
+}
+
+func (configuration *Configuration) ListTriggers() map[string]models.Trigger {
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	return maps.Clone(configuration.Triggers)
+}
+
+func (configuration *Configuration) ListTokens() map[string]models.Token {
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	return maps.Clone(configuration.Tokens)
+}
+
+func (configuration *Configuration) GetServerSettings() models.ServerSettings {
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	return configuration.Server
+}
+
+func (configuration *Configuration) ListNotifiers() map[string]models.Notifier {
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	return maps.Clone(configuration.Notifiers)
+}
+
+func (configuration *Configuration) GetClientRateLimit() *models.RateLimit {
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	return configuration.ClientRateLimit
+}
+
+func (configuration *Configuration) SetServerSettings(settings models.ServerSettings) {
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	configuration.Server = settings
+}
+
+func (configuration *Configuration) AddTrigger(name string, trigger models.Trigger) error {
+	if !isValidActionName(name) {
+		return fmt.Errorf("invalid trigger name: use only letters, numbers, dash and underscore")
+	}
+
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	if _, exists := configuration.Actions[normalizeActionName(trigger.Action)]; !exists {
+		return fmt.Errorf("action not found: %s", trigger.Action)
+	}
+
+	configuration.Triggers[name] = trigger
+	return nil
+}
+
+func (configuration *Configuration) AddToken(name string, token models.Token) error {
+	if !isValidTokenName(name) {
+		return fmt.Errorf("invalid token name: use only letters, numbers, dash and underscore")
+	}
+
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	if _, exists := configuration.Tokens[name]; exists {
+		return fmt.Errorf("token already exists: %s", name)
+	}
+
+	if err := ValidateScopes(token.Scopes); err != nil {
+		return err
+	}
+
+	configuration.Tokens[name] = token
+	return nil
+}
+
+func (configuration *Configuration) RevokeToken(name string) error {
+	configuration.mutex.Lock()
+	defer configuration.mutex.Unlock()
+
+	if _, exists := configuration.Tokens[name]; !exists {
+		return fmt.Errorf("token not found: %s", name)
+	}
+
+	delete(configuration.Tokens, name)
+	return nil
+}
+
+func (configuration *Configuration) AuthenticateToken(rawToken string) (string, models.Token, bool) {
+	presentedHash := []byte(HashToken(rawToken))
+
+	configuration.mutex.RLock()
+	defer configuration.mutex.RUnlock()
+
+	for name, token := range configuration.Tokens {
+		if subtle.ConstantTimeCompare(presentedHash, []byte(token.Hash)) == 1 {
+			return name, token, true
+		}
+	}
+
+	return "", models.Token{}, false
+}
+
 func normalizeActionName(name string) string {
 	return name
 }
@@ -130,3 +412,10 @@ func isValidActionName(name string) bool {
 	}
 	return actionNamePattern.MatchString(name)
 }
+
+func isValidTokenName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	return actionNamePattern.MatchString(name)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const configurationReloadDebounce = 300 * time.Millisecond
+
+// configurationReloadWait bounds how long local commands wait for the server
+// to pick up a configuration they just saved.
+const configurationReloadWait = 2 * time.Second
+
+func (server *Server) currentConfiguration() *Configuration {
+	return server.configuration.Load()
+}
+
+// applyTriggers brings the running triggers in line with configuration,
+// leaving the unchanged ones running.
+func (server *Server) applyTriggers(configuration *Configuration) {
+	server.scheduler.Apply(configuration)
+	server.watcher.Apply(configuration)
+}
+
+func (server *Server) stopTriggers() {
+	server.scheduler.Stop()
+	server.watcher.Stop()
+}
+
+func (server *Server) ReloadConfiguration() error {
+	server.reloadMutex.Lock()
+	defer server.reloadMutex.Unlock()
+
+	configuration := NewConfiguration()
+	if err := configuration.Load(); err != nil {
+		slog.Error("configuration reload rejected, keeping the current one", "error", err)
+		server.recordReloadFailure(err)
+		server.metrics.ReloadFinished(err)
+		return err
+	}
+
+	if err := server.validator.ValidateConfiguration(configuration, server.currentConfiguration()); err != nil {
+		slog.Error("configuration reload rejected, keeping the current one", "error", err)
+		server.recordReloadFailure(err)
+		server.metrics.ReloadFinished(err)
+		return err
+	}
+
+	if configuration.GetServerSettings() != server.currentConfiguration().GetServerSettings() {
+		slog.Warn("server settings changed, restart dsw to apply them")
+	}
+
+	server.configuration.Store(configuration)
+	server.applyTriggers(configuration)
+	server.recordConfigurationLoad(configuration)
+
+	slog.Info("configuration reloaded", "actions", len(configuration.ListActions()))
+	server.metrics.ReloadFinished(nil)
+	return nil
+}
+
+func (server *Server) watchConfigurationFile() error {
+	configPath, err := server.currentConfiguration().GetConfigPath()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create configuration watcher: %w", err)
+	}
+
+	// Watch the directory: saves replace the file through a rename.
+	if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch configuration directory: %w", err)
+	}
+
+	server.configurationWatcher = watcher
+	go server.configurationWatchLoop(watcher, configPath)
+	return nil
+}
+
+func (server *Server) stopConfigurationWatcher() {
+	if server.configurationWatcher != nil {
+		server.configurationWatcher.Close()
+	}
+}
+
+func (server *Server) configurationWatchLoop(watcher *fsnotify.Watcher, configPath string) {
+	var debounceTimer *time.Timer
+
+	for {
+		select {
+		case event, open := <-watcher.Events:
+			if !open {
+				return
+			}
+
+			if event.Name != configPath || event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+
+			if debounceTimer != nil {
+				debounceTimer.Stop()
+			}
+
+			debounceTimer = time.AfterFunc(configurationReloadDebounce, func() {
+				slog.Info("configuration file changed, reloading")
+				server.ReloadConfiguration()
+			})
+
+		case err, open := <-watcher.Errors:
+			if !open {
+				return
+			}
+			slog.Error("configuration watch error", "error", err)
+		}
+	}
+}
@@ -33,7 +33,7 @@ func (daemon *Daemon) getLogPath() (string, error) {
 	return filepath.Join(logDir, "dsw.log"), nil
 }
 
-func (daemon *Daemon) StartDaemon(port int) error {
+func (daemon *Daemon) StartDaemon() error {
 	pidPath, err := daemon.configuration.GetPIDPath()
 	if err != nil {
 		return err
@@ -59,7 +59,7 @@ func (daemon *Daemon) StartDaemon(port int) error {
 	}
 	defer logFile.Close()
 
-	command := exec.Command(executable, "serve", "-p", strconv.Itoa(port))
+	command := exec.Command(executable, "serve")
 	command.Stdout = logFile
 	command.Stderr = logFile
 	command.Stdin = nil
@@ -79,7 +79,7 @@ func (daemon *Daemon) StartDaemon(port int) error {
 
 	command.Process.Release()
 
-	fmt.Printf("Daemon started with PID %d on port %d\n", pid, port)
+	fmt.Printf("Daemon started with PID %d on %s\n", pid, describeListeners(daemon.configuration))
 	fmt.Printf("Logs: %s\n", logPath)
 	return nil
 }
@@ -121,26 +121,34 @@ func (daemon *Daemon) StopDaemon() error {
 }
 
 func (daemon *Daemon) IsRunning() bool {
+	_, running := daemon.RunningPID()
+	return running
+}
+
+func (daemon *Daemon) RunningPID() (int, bool) {
 	pidPath, err := daemon.configuration.GetPIDPath()
 	if err != nil {
-		return false
+		return 0, false
 	}
 
 	pidData, err := os.ReadFile(pidPath)
 	if err != nil {
-		return false
+		return 0, false
 	}
 
 	pid, err := strconv.Atoi(string(pidData))
 	if err != nil {
-		return false
+		return 0, false
 	}
 
 	process, err := os.FindProcess(pid)
 	if err != nil {
-		return false
+		return 0, false
+	}
+
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		return 0, false
 	}
 
-	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	return pid, true
 }
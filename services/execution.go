@@ -0,0 +1,77 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+const (
+	SourceAPI      = "api"
+	SourceWebhook  = "webhook"
+	SourceSchedule = "schedule"
+	SourceWatch    = "watch"
+	SourceCLI      = "cli"
+	SourceWorkflow = "workflow"
+)
+
+// Caller is the token name for API runs, the trigger name for scheduled and
+// watch runs, the workflow for its steps, and the local user for dsw run.
+type Execution struct {
+	ActionName  string
+	Action      models.Action
+	Parameters  map[string]string
+	Environment map[string]string
+	Source      string
+	Caller      string
+	RequestID   string
+}
+
+func placeholderNames(value string) []string {
+	var names []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(value, -1) {
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// bindShellArguments replaces placeholders with references to positional
+// shell parameters, so values reach the command as data and are never parsed
+// as shell syntax.
+func bindShellArguments(args []string, parameters map[string]string) ([]string, []string) {
+	boundArgs := make([]string, len(args))
+	var positionalValues []string
+	positions := make(map[string]int)
+
+	for index, argument := range args {
+		boundArgs[index] = placeholderPattern.ReplaceAllStringFunc(argument, func(placeholder string) string {
+			name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+
+			position, bound := positions[name]
+			if !bound {
+				positionalValues = append(positionalValues, parameters[name])
+				position = len(positionalValues)
+				positions[name] = position
+			}
+
+			return `"${` + strconv.Itoa(position) + `}"`
+		})
+	}
+
+	return boundArgs, positionalValues
+}
+
+func bindArguments(args []string, parameters map[string]string) []string {
+	boundArgs := make([]string, len(args))
+	for index, argument := range args {
+		boundArgs[index] = placeholderPattern.ReplaceAllStringFunc(argument, func(placeholder string) string {
+			return parameters[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+		})
+	}
+
+	return boundArgs
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/albertoboccolini/dsw/models"
@@ -13,36 +15,141 @@ import (
 
 const commandTimeout = 60 * time.Second
 
-type Executor struct{}
+type Executor struct {
+	metrics       *Metrics
+	validator     *Validator
+	resolveAction ActionResolver
+	runStep       StepRunner
+}
+
+// NewExecutor runs workflow steps in place when runStep is nil.
+func NewExecutor(metrics *Metrics, validator *Validator, resolveAction ActionResolver, runStep StepRunner) *Executor {
+	return &Executor{
+		metrics:       metrics,
+		validator:     validator,
+		resolveAction: resolveAction,
+		runStep:       runStep,
+	}
+}
+
+const processGroupWaitDelay = 5 * time.Second
 
-func NewExecutor() *Executor {
-	return &Executor{}
+func (executor *Executor) Execute(ctx context.Context, execution Execution) models.ApiResponse {
+	return executor.ExecuteStreaming(ctx, execution, nil)
 }
 
-func (executor *Executor) Execute(action models.Action) models.ApiResponse {
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+func (executor *Executor) ExecuteStreaming(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+	executor.metrics.ExecutionStarted(execution.ActionName)
+
+	startTime := time.Now()
+	var result models.ApiResponse
+	if execution.Action.Retry != nil {
+		result = executor.executeWithRetry(ctx, execution, listener)
+	} else {
+		result = executor.executeAttempt(ctx, execution, listener)
+	}
+	duration := time.Since(startTime)
+	result.DurationMs = duration.Milliseconds()
+
+	executor.metrics.ExecutionFinished(execution.ActionName, result, duration)
+	return result
+}
+
+// executeAttempt runs the action once, applying its timeout.
+func (executor *Executor) executeAttempt(parentCtx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout := timeoutOf(execution.Action); timeout > 0 {
+		ctx, cancel = context.WithTimeout(parentCtx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parentCtx)
+	}
 	defer cancel()
 
 	startTime := time.Now()
-	result := executor.executeCommand(ctx, action)
+	var result models.ApiResponse
+	if execution.Action.IsWorkflow() {
+		result = executor.executeWorkflow(ctx, execution, listener)
+	} else {
+		result = executor.executeCommand(ctx, execution, listener)
+	}
 	result.DurationMs = time.Since(startTime).Milliseconds()
 
 	return result
 }
 
-func (executor *Executor) executeCommand(ctx context.Context, action models.Action) models.ApiResponse {
+// timeoutOf returns 0 for workflows without a timeout of their own, which
+// are bounded by the timeouts of their steps.
+func timeoutOf(action models.Action) time.Duration {
+	if action.Timeout > 0 {
+		return action.Timeout
+	}
+
+	if action.IsWorkflow() {
+		return 0
+	}
+
+	return commandTimeout
+}
+
+func buildEnvironment(overrideSets ...map[string]string) []string {
+	environment := os.Environ()
+	for _, overrides := range overrideSets {
+		for _, name := range sortedKeys(overrides) {
+			environment = append(environment, name+"="+overrides[name])
+		}
+	}
+
+	return environment
+}
+
+func commandLine(execution Execution) []string {
+	action := execution.Action
+
+	if !action.UsesShell() {
+		return append([]string{action.Command}, bindArguments(action.Args, execution.Parameters)...)
+	}
+
+	args, positionalValues := bindShellArguments(action.Args, execution.Parameters)
+
 	fullCommand := action.Command
-	if len(action.Args) > 0 {
-		fullCommand = action.Command + " " + strings.Join(action.Args, " ")
+	if len(args) > 0 {
+		fullCommand = action.Command + " " + strings.Join(args, " ")
+	}
+
+	return append([]string{"sh", "-c", fullCommand, "dsw"}, positionalValues...)
+}
+
+func (executor *Executor) PrepareCommand(ctx context.Context, execution Execution) *exec.Cmd {
+	argv := commandLine(execution)
+
+	command := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	command.Cancel = func() error {
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
 	}
+	command.WaitDelay = processGroupWaitDelay
+	command.Dir = execution.Action.WorkDir
+	command.Env = buildEnvironment(execution.Action.Env, execution.Environment)
+
+	return command
+}
 
-	command := exec.CommandContext(ctx, "sh", "-c", fullCommand)
+func (executor *Executor) executeCommand(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+	action := execution.Action
+	command := executor.PrepareCommand(ctx, execution)
 
-	var stdoutBuffer, stderrBuffer bytes.Buffer
-	command.Stdout = &stdoutBuffer
-	command.Stderr = &stderrBuffer
+	stdoutWriter := newLineWriter(streamStdout, listener)
+	stderrWriter := newLineWriter(streamStderr, listener)
+	command.Stdout = stdoutWriter
+	command.Stderr = stderrWriter
 
 	err := command.Run()
+	stdoutWriter.Flush()
+	stderrWriter.Flush()
+
+	stdoutBuffer := &stdoutWriter.output
+	stderrBuffer := &stderrWriter.output
 
 	combinedOutput := stdoutBuffer.String()
 	if stderrBuffer.Len() > 0 {
@@ -54,26 +161,40 @@ func (executor *Executor) executeCommand(ctx context.Context, action models.Acti
 	}
 
 	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return models.ApiResponse{
+				Success:   false,
+				Output:    combinedOutput,
+				Message:   "Command cancelled",
+				ExitCode:  -1,
+				Cancelled: true,
+			}
+		}
+
 		if ctx.Err() == context.DeadlineExceeded {
 			return models.ApiResponse{
-				Success: false,
-				Output:  combinedOutput,
-				Message: "Command timed out after 60 seconds",
+				Success:  false,
+				Output:   combinedOutput,
+				Message:  fmt.Sprintf("Command timed out after %s", timeoutOf(action)),
+				ExitCode: -1,
+				TimedOut: true,
 			}
 		}
 
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return models.ApiResponse{
-				Success: false,
-				Output:  combinedOutput,
-				Message: fmt.Sprintf("Command failed with exit code %d", exitErr.ExitCode()),
+				Success:  false,
+				Output:   combinedOutput,
+				Message:  fmt.Sprintf("Command failed with exit code %d", exitErr.ExitCode()),
+				ExitCode: exitErr.ExitCode(),
 			}
 		}
 
 		return models.ApiResponse{
-			Success: false,
-			Output:  combinedOutput,
-			Message: fmt.Sprintf("Command error: %v", err),
+			Success:  false,
+			Output:   combinedOutput,
+			Message:  fmt.Sprintf("Command error: %v", err),
+			ExitCode: -1,
 		}
 	}
 
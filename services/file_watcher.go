@@ -0,0 +1,371 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+	"github.com/fsnotify/fsnotify"
+)
+
+const defaultWatchDebounce = 500 * time.Millisecond
+
+var watchEventOperations = map[string]fsnotify.Op{
+	"create": fsnotify.Create,
+	"write":  fsnotify.Write,
+	"remove": fsnotify.Remove,
+	"rename": fsnotify.Rename,
+	"chmod":  fsnotify.Chmod,
+}
+
+var watchEventNames = []string{"create", "write", "remove", "rename", "chmod"}
+var defaultWatchEvents = []string{"create", "write", "remove", "rename"}
+
+type watchTarget struct {
+	root    string
+	pattern string
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~")), nil
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func parseWatchPath(rawPath string) (watchTarget, error) {
+	path, err := expandHome(rawPath)
+	if err != nil {
+		return watchTarget{}, err
+	}
+
+	if !filepath.IsAbs(path) {
+		return watchTarget{}, fmt.Errorf("watch path must be absolute or start with ~/: %s", rawPath)
+	}
+
+	path = filepath.Clean(path)
+	directory, base := filepath.Split(path)
+	directory = filepath.Clean(directory)
+
+	if hasGlobMeta(directory) {
+		return watchTarget{}, fmt.Errorf("globs are only supported in the last path element: %s", rawPath)
+	}
+
+	if hasGlobMeta(base) {
+		if _, err := filepath.Match(base, ""); err != nil {
+			return watchTarget{}, fmt.Errorf("invalid watch pattern %q: %w", rawPath, err)
+		}
+
+		return watchTarget{root: directory, pattern: base}, nil
+	}
+
+	if fileInfo, err := os.Stat(path); err == nil && fileInfo.IsDir() {
+		return watchTarget{root: path}, nil
+	}
+
+	return watchTarget{root: directory, pattern: base}, nil
+}
+
+func (target watchTarget) matches(eventPath string, recursive bool) bool {
+	relativePath, err := filepath.Rel(target.root, eventPath)
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return false
+	}
+
+	if !recursive && filepath.Dir(eventPath) != target.root {
+		return false
+	}
+
+	if target.pattern == "" {
+		return true
+	}
+
+	matched, err := filepath.Match(target.pattern, filepath.Base(eventPath))
+	return err == nil && matched
+}
+
+func watchEventName(operation fsnotify.Op) string {
+	for _, name := range watchEventNames {
+		if operation.Has(watchEventOperations[name]) {
+			return name
+		}
+	}
+
+	return operation.String()
+}
+
+type FileWatcher struct {
+	mutex     sync.Mutex
+	validator *Validator
+	jobs      *JobManager
+	running   map[string]*runningTrigger
+}
+
+func NewFileWatcher(validator *Validator, jobs *JobManager) *FileWatcher {
+	return &FileWatcher{
+		validator: validator,
+		jobs:      jobs,
+		running:   make(map[string]*runningTrigger),
+	}
+}
+
+// Apply starts, restarts and stops watch triggers to match the
+// configuration. Unchanged triggers keep running with their pending
+// debounces.
+func (fileWatcher *FileWatcher) Apply(configuration *Configuration) {
+	fileWatcher.mutex.Lock()
+	defer fileWatcher.mutex.Unlock()
+
+	triggers := configuration.ListTriggers()
+
+	for triggerName, running := range fileWatcher.running {
+		trigger, exists := triggers[triggerName]
+		action, _ := configuration.GetAction(trigger.Action)
+		if exists && trigger.Watch != nil && running.matches(trigger, action) {
+			continue
+		}
+
+		running.halt()
+		delete(fileWatcher.running, triggerName)
+	}
+
+	for triggerName, trigger := range triggers {
+		if _, running := fileWatcher.running[triggerName]; running || trigger.Watch == nil {
+			continue
+		}
+
+		if err := fileWatcher.startTrigger(configuration, triggerName, trigger); err != nil {
+			slog.Error("skipping invalid watch trigger", "trigger", triggerName, "error", err)
+		}
+	}
+}
+
+func (fileWatcher *FileWatcher) Stop() {
+	fileWatcher.mutex.Lock()
+	defer fileWatcher.mutex.Unlock()
+
+	for triggerName, running := range fileWatcher.running {
+		running.halt()
+		delete(fileWatcher.running, triggerName)
+	}
+}
+
+func (fileWatcher *FileWatcher) startTrigger(configuration *Configuration, triggerName string, trigger models.Trigger) error {
+	action, exists := configuration.GetAction(trigger.Action)
+	if !exists {
+		return fmt.Errorf("action not found: %s", trigger.Action)
+	}
+
+	if err := fileWatcher.validator.ValidateTrigger(trigger, action); err != nil {
+		return err
+	}
+
+	targets := make([]watchTarget, 0, len(trigger.Watch.Paths))
+	for _, rawPath := range trigger.Watch.Paths {
+		target, _ := parseWatchPath(rawPath)
+		targets = append(targets, target)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	for _, target := range targets {
+		if err := addWatchDirectory(watcher, target.root, trigger.Watch.Recursive); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	slog.Info("watching paths", "trigger", triggerName, "action", trigger.Action, "paths", trigger.Watch.Paths)
+
+	running := newRunningTrigger(trigger, action)
+	fileWatcher.running[triggerName] = running
+	go fileWatcher.loop(triggerName, trigger, action, watcher, targets, running)
+	return nil
+}
+
+func addWatchDirectory(watcher *fsnotify.Watcher, root string, recursive bool) error {
+	if !recursive {
+		if err := watcher.Add(root); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", root, err)
+		}
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk %s: %w", path, err)
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// settledPath is sent by a path's debounce timer. Timers are replaced rather
+// than reset, and one that fired just before being replaced carries a stale
+// generation and is ignored.
+type settledPath struct {
+	path       string
+	generation int
+}
+
+func (fileWatcher *FileWatcher) loop(triggerName string, trigger models.Trigger, action models.Action, watcher *fsnotify.Watcher, targets []watchTarget, running *runningTrigger) {
+	defer close(running.done)
+	defer watcher.Close()
+
+	watch := trigger.Watch
+	events := watch.Events
+	if len(events) == 0 {
+		events = defaultWatchEvents
+	}
+
+	debounce := watch.Debounce
+	if debounce == 0 {
+		debounce = defaultWatchDebounce
+	}
+
+	pendingEvents := make(map[string]string)
+	timers := make(map[string]*time.Timer)
+	generations := make(map[string]int)
+	generation := 0
+	settled := make(chan settledPath)
+	stop := running.stop
+
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case err, open := <-watcher.Errors:
+			if !open {
+				return
+			}
+			slog.Error("watch error", "trigger", triggerName, "error", err)
+
+		case event, open := <-watcher.Events:
+			if !open {
+				return
+			}
+
+			if watch.Recursive && event.Has(fsnotify.Create) {
+				if fileInfo, err := os.Stat(event.Name); err == nil && fileInfo.IsDir() {
+					if err := addWatchDirectory(watcher, event.Name, true); err != nil {
+						slog.Warn("failed to watch new directory", "trigger", triggerName, "error", err)
+					}
+				}
+			}
+
+			eventName := watchEventName(event.Op)
+			if !slices.Contains(events, eventName) || !matchesAnyTarget(targets, event.Name, watch.Recursive) {
+				continue
+			}
+
+			eventPath := event.Name
+			pendingEvents[eventPath] = eventName
+			if timer, exists := timers[eventPath]; exists {
+				timer.Stop()
+			}
+
+			generation++
+			generations[eventPath] = generation
+			timerEvent := settledPath{path: eventPath, generation: generation}
+			timers[eventPath] = time.AfterFunc(debounce, func() {
+				select {
+				case settled <- timerEvent:
+				case <-stop:
+				}
+			})
+
+		case timerEvent := <-settled:
+			eventPath := timerEvent.path
+			if generations[eventPath] != timerEvent.generation {
+				continue
+			}
+
+			eventName := pendingEvents[eventPath]
+			delete(pendingEvents, eventPath)
+			delete(timers, eventPath)
+			delete(generations, eventPath)
+
+			fileWatcher.run(triggerName, trigger, action, eventPath, eventName)
+		}
+	}
+}
+
+func matchesAnyTarget(targets []watchTarget, eventPath string, recursive bool) bool {
+	for _, target := range targets {
+		if target.matches(eventPath, recursive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (fileWatcher *FileWatcher) run(triggerName string, trigger models.Trigger, action models.Action, eventPath string, eventName string) {
+	values := maps.Clone(trigger.Parameters)
+	if values == nil {
+		values = make(map[string]string)
+	}
+
+	if trigger.Watch.Parameter != "" {
+		values[trigger.Watch.Parameter] = eventPath
+	}
+
+	parameters, err := fileWatcher.validator.ValidateParameters(action, values)
+	if err != nil {
+		slog.Warn("skipping watch event", "trigger", triggerName, "path", eventPath, "error", err)
+		return
+	}
+
+	slog.Info("running watch action", "trigger", triggerName, "action", trigger.Action, "path", eventPath, "event", eventName)
+
+	_, err = fileWatcher.jobs.Submit(Execution{
+		ActionName: trigger.Action,
+		Action:     action,
+		Parameters: parameters,
+		Environment: map[string]string{
+			"DSW_TRIGGER":       triggerName,
+			"DSW_TRIGGER_PATH":  eventPath,
+			"DSW_TRIGGER_EVENT": eventName,
+		},
+		Source: SourceWatch,
+		Caller: triggerName,
+	})
+	if err != nil {
+		slog.Warn("skipping watch event", "trigger", triggerName, "path", eventPath, "error", err)
+	}
+}
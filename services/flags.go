@@ -0,0 +1,38 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type keyValueFlag map[string]string
+
+func (keyValues keyValueFlag) String() string {
+	pairs := make([]string, 0, len(keyValues))
+	for _, key := range sortedKeys(keyValues) {
+		pairs = append(pairs, key+"="+keyValues[key])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (keyValues keyValueFlag) Set(value string) error {
+	key, content, found := strings.Cut(value, "=")
+	if !found || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
+	}
+
+	keyValues[key] = content
+	return nil
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
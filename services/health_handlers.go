@@ -0,0 +1,62 @@
+package services
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusReady    = "ready"
+	healthStatusNotReady = "not_ready"
+)
+
+func (server *Server) recordConfigurationLoad(configuration *Configuration) {
+	status := models.ConfigurationStatus{
+		Actions:  len(configuration.ListActions()),
+		Triggers: len(configuration.ListTriggers()),
+		LoadedAt: time.Now(),
+	}
+
+	if previousStatus := server.configurationStatus.Load(); previousStatus != nil {
+		status.LastReloadAt = &status.LoadedAt
+	}
+
+	server.configurationStatus.Store(&status)
+}
+
+func (server *Server) recordReloadFailure(err error) {
+	status := *server.configurationStatus.Load()
+	failedAt := time.Now()
+	status.LastReloadAt = &failedAt
+	status.LastReloadError = err.Error()
+
+	server.configurationStatus.Store(&status)
+}
+
+func (server *Server) healthStatus(status string) models.HealthStatus {
+	return models.HealthStatus{
+		Status:        status,
+		Version:       models.VERSION,
+		StartedAt:     server.startedAt,
+		UptimeSeconds: int64(time.Since(server.startedAt).Seconds()),
+		Configuration: *server.configurationStatus.Load(),
+	}
+}
+
+func (serverHandler *ServerHandler) handleHealth(responseWriter http.ResponseWriter, request *http.Request) {
+	serverHandler.Server.respondJSON(responseWriter, http.StatusOK, serverHandler.Server.healthStatus(healthStatusOK))
+}
+
+// handleReady reports not ready until the triggers are started and again once
+// shutdown begins, so probes stop routing to a server that is going away.
+func (serverHandler *ServerHandler) handleReady(responseWriter http.ResponseWriter, request *http.Request) {
+	if !serverHandler.Server.ready.Load() {
+		serverHandler.Server.respondJSON(responseWriter, http.StatusServiceUnavailable, serverHandler.Server.healthStatus(healthStatusNotReady))
+		return
+	}
+
+	serverHandler.Server.respondJSON(responseWriter, http.StatusOK, serverHandler.Server.healthStatus(healthStatusReady))
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const (
+	maxHistoryEntries      = 5000
+	maxHistoryAge          = 30 * 24 * time.Hour
+	maxHistoryOutputBytes  = 4096
+	historyCompactionSlack = 500
+	defaultHistoryLimit    = 100
+)
+
+type HistoryFilter struct {
+	Action string
+	Status models.JobState
+	Since  time.Time
+	Limit  int
+	Scopes []string
+}
+
+// HistoryStore appends one JSON line per execution. The file is compacted to
+// the retention limits when it first opens and whenever it grows past them.
+type HistoryStore struct {
+	mutex      sync.Mutex
+	filePath   string
+	entryCount int
+	counted    bool
+}
+
+func NewHistoryStore(filePath string) *HistoryStore {
+	return &HistoryStore{
+		filePath: filePath,
+	}
+}
+
+func NewHistoryEntry(job models.Job, execution Execution) models.HistoryEntry {
+	entry := models.HistoryEntry{
+		JobID:     job.ID,
+		Action:    execution.ActionName,
+		Source:    execution.Source,
+		Caller:    execution.Caller,
+		RequestID: execution.RequestID,
+		Status:    job.State,
+	}
+
+	// Jobs that never ran are dated by when they were requested.
+	entry.StartedAt = job.CreatedAt
+	if job.StartedAt != nil {
+		entry.StartedAt = *job.StartedAt
+	}
+
+	if job.FinishedAt != nil {
+		entry.FinishedAt = *job.FinishedAt
+	}
+
+	if job.Result != nil {
+		entry.DurationMs = job.Result.DurationMs
+		entry.ExitCode = job.Result.ExitCode
+		entry.Message = job.Result.Message
+		entry.Output, entry.OutputTruncated = truncateOutput(job.Result.Output)
+	}
+
+	return entry
+}
+
+// truncateOutput keeps the end of the output, where errors usually are.
+func truncateOutput(output string) (string, bool) {
+	if len(output) <= maxHistoryOutputBytes {
+		return output, false
+	}
+
+	return strings.ToValidUTF8(output[len(output)-maxHistoryOutputBytes:], ""), true
+}
+
+func (historyStore *HistoryStore) Append(entry models.HistoryEntry) error {
+	if historyStore == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+
+	historyStore.mutex.Lock()
+	defer historyStore.mutex.Unlock()
+
+	if !historyStore.counted || historyStore.entryCount >= maxHistoryEntries+historyCompactionSlack {
+		if err := historyStore.compact(); err != nil {
+			slog.Warn("failed to compact history", "error", err)
+		}
+	}
+
+	historyFile, err := os.OpenFile(historyStore.filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer historyFile.Close()
+
+	if _, err := historyFile.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	historyStore.entryCount++
+	return nil
+}
+
+func (historyStore *HistoryStore) Query(filter HistoryFilter) ([]models.HistoryEntry, error) {
+	if historyStore == nil {
+		return []models.HistoryEntry{}, nil
+	}
+
+	historyStore.mutex.Lock()
+	entries, err := historyStore.readEntries()
+	historyStore.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultHistoryLimit
+	}
+
+	cutoff := time.Now().Add(-maxHistoryAge)
+	if filter.Since.After(cutoff) {
+		cutoff = filter.Since
+	}
+
+	matchingEntries := []models.HistoryEntry{}
+	for _, entry := range slices.Backward(entries) {
+		if len(matchingEntries) >= filter.Limit {
+			break
+		}
+
+		if entry.StartedAt.Before(cutoff) {
+			continue
+		}
+
+		if filter.Action != "" && entry.Action != filter.Action {
+			continue
+		}
+
+		if filter.Status != "" && entry.Status != filter.Status {
+			continue
+		}
+
+		if !isActionInScope(filter.Scopes, entry.Action) {
+			continue
+		}
+
+		matchingEntries = append(matchingEntries, entry)
+	}
+
+	return matchingEntries, nil
+}
+
+// ParseHistorySince accepts an RFC 3339 timestamp or a duration back from now.
+func ParseHistorySince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since value: %s (use a duration like 24h or an RFC 3339 time)", value)
+	}
+
+	return since, nil
+}
+
+func ParseHistoryStatus(value string) (models.JobState, error) {
+	status := models.JobState(value)
+	switch status {
+	case "", models.JobSucceeded, models.JobFailed, models.JobTimedOut, models.JobCancelled, models.JobRejected:
+		return status, nil
+	default:
+		return "", fmt.Errorf("invalid status: %s (use succeeded, failed, timed_out, cancelled or rejected)", value)
+	}
+}
+
+func (historyStore *HistoryStore) readEntries() ([]models.HistoryEntry, error) {
+	data, err := os.ReadFile(historyStore.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var entries []models.HistoryEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry models.HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func (historyStore *HistoryStore) compact() error {
+	entries, err := historyStore.readEntries()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-maxHistoryAge)
+	retainedEntries := slices.DeleteFunc(entries, func(entry models.HistoryEntry) bool {
+		return entry.StartedAt.Before(cutoff)
+	})
+	if len(retainedEntries) > maxHistoryEntries {
+		retainedEntries = retainedEntries[len(retainedEntries)-maxHistoryEntries:]
+	}
+
+	historyStore.entryCount = len(retainedEntries)
+	historyStore.counted = true
+
+	if len(retainedEntries) == len(entries) {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, entry := range retainedEntries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode history entry: %w", err)
+		}
+	}
+
+	tempPath := historyStore.filePath + ".tmp"
+	if err := os.WriteFile(tempPath, buffer.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	if err := os.Rename(tempPath, historyStore.filePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename history: %w", err)
+	}
+
+	return nil
+}
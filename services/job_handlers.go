@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/albertoboccolini/dsw/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type JobsResponse struct {
+	Jobs        []models.Job `json:"jobs"`
+	Running     int          `json:"running"`
+	Queued      int          `json:"queued"`
+	MaxParallel int          `json:"max_parallel,omitempty"`
+}
+
+type SchedulesResponse struct {
+	Schedules []models.ScheduleStatus `json:"schedules"`
+}
+
+type HistoryResponse struct {
+	Entries []models.HistoryEntry `json:"entries"`
+}
+
+func (serverHandler *ServerHandler) handleListJobs(responseWriter http.ResponseWriter, request *http.Request) {
+	scopes := tokenScopesFromContext(request.Context())
+
+	response := JobsResponse{
+		Jobs:        []models.Job{},
+		MaxParallel: serverHandler.Server.jobs.MaxParallel(),
+	}
+	for _, job := range serverHandler.Server.jobs.List() {
+		if !isActionInScope(scopes, job.Action) {
+			continue
+		}
+
+		response.Jobs = append(response.Jobs, job)
+		switch job.State {
+		case models.JobRunning:
+			response.Running++
+		case models.JobQueued:
+			response.Queued++
+		}
+	}
+
+	serverHandler.Server.respondJSON(responseWriter, http.StatusOK, response)
+}
+
+func (serverHandler *ServerHandler) handleGetJob(responseWriter http.ResponseWriter, request *http.Request) {
+	jobID := chi.URLParam(request, "jobID")
+
+	job, exists := serverHandler.Server.jobs.Get(jobID)
+	if !exists || !isActionInScope(tokenScopesFromContext(request.Context()), job.Action) {
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("job not found: %s", jobID), http.StatusNotFound)
+		return
+	}
+
+	serverHandler.Server.respondJSON(responseWriter, http.StatusOK, job)
+}
+
+func (serverHandler *ServerHandler) handleCancelJob(responseWriter http.ResponseWriter, request *http.Request) {
+	jobID := chi.URLParam(request, "jobID")
+
+	job, exists := serverHandler.Server.jobs.Get(jobID)
+	if !exists || !isActionInScope(tokenScopesFromContext(request.Context()), job.Action) {
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("job not found: %s", jobID), http.StatusNotFound)
+		return
+	}
+
+	job, err := serverHandler.Server.jobs.Cancel(jobID)
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("job not found: %s", jobID), http.StatusNotFound)
+	case errors.Is(err, ErrJobFinished):
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("job already finished: %s", jobID), http.StatusConflict)
+	default:
+		serverHandler.Server.respondJSON(responseWriter, http.StatusAccepted, job)
+	}
+}
+
+func (serverHandler *ServerHandler) handleListSchedules(responseWriter http.ResponseWriter, request *http.Request) {
+	scopes := tokenScopesFromContext(request.Context())
+
+	visibleSchedules := []models.ScheduleStatus{}
+	for _, status := range serverHandler.Server.scheduler.Statuses() {
+		if isActionInScope(scopes, status.Action) {
+			visibleSchedules = append(visibleSchedules, status)
+		}
+	}
+
+	serverHandler.Server.respondJSON(responseWriter, http.StatusOK, SchedulesResponse{Schedules: visibleSchedules})
+}
+
+func (serverHandler *ServerHandler) handleListHistory(responseWriter http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	status, err := ParseHistoryStatus(query.Get("status"))
+	if err != nil {
+		serverHandler.Server.respondError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	since, err := ParseHistorySince(query.Get("since"))
+	if err != nil {
+		serverHandler.Server.respondError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if limitValue := query.Get("limit"); limitValue != "" {
+		limit, err = strconv.Atoi(limitValue)
+		if err != nil || limit < 1 {
+			serverHandler.Server.respondError(responseWriter, fmt.Sprintf("invalid limit: %s", limitValue), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := serverHandler.Server.history.Query(HistoryFilter{
+		Action: query.Get("action"),
+		Status: status,
+		Since:  since,
+		Limit:  limit,
+		Scopes: tokenScopesFromContext(request.Context()),
+	})
+	if err != nil {
+		slog.Error("failed to query history", "error", err)
+		serverHandler.Server.respondError(responseWriter, "failed to read history", http.StatusInternalServerError)
+		return
+	}
+
+	serverHandler.Server.respondJSON(responseWriter, http.StatusOK, HistoryResponse{Entries: entries})
+}
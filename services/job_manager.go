@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const maxFinishedJobs = 200
+const jobIDByteLength = 8
+
+var ErrJobNotFound = errors.New("job not found")
+var ErrJobFinished = errors.New("job already finished")
+var ErrActionBusy = errors.New("action already running")
+
+type JobManager struct {
+	mutex          sync.RWMutex
+	executor       *Executor
+	history        *HistoryStore
+	notifications  *NotificationDispatcher
+	maxParallel    int
+	jobs           map[string]*models.Job
+	contexts       map[string]context.Context
+	cancels        map[string]context.CancelFunc
+	slots          map[string]*jobSlot
+	queue          []*jobSlot
+	running        int
+	runningActions map[string]int
+}
+
+// jobSlot holds a job in the queue until the global limit and the action's
+// concurrency policy let it start. Workflow jobs do not count against the
+// global limit, since their steps take slots of their own.
+type jobSlot struct {
+	jobID      string
+	actionName string
+	exclusive  bool
+	counted    bool
+	granted    bool
+	ready      chan struct{}
+}
+
+func NewJobManager(executor *Executor, history *HistoryStore, notifications *NotificationDispatcher, maxParallel int) *JobManager {
+	return &JobManager{
+		executor:       executor,
+		history:        history,
+		notifications:  notifications,
+		maxParallel:    maxParallel,
+		jobs:           make(map[string]*models.Job),
+		contexts:       make(map[string]context.Context),
+		cancels:        make(map[string]context.CancelFunc),
+		slots:          make(map[string]*jobSlot),
+		runningActions: make(map[string]int),
+	}
+}
+
+func generateJobID() string {
+	randomBytes := make([]byte, jobIDByteLength)
+	rand.Read(randomBytes)
+	return hex.EncodeToString(randomBytes)
+}
+
+func (jobManager *JobManager) Submit(execution Execution) (models.Job, error) {
+	job, err := jobManager.Create(execution)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	go jobManager.Execute(job.ID, execution, nil)
+	return job, nil
+}
+
+func (jobManager *JobManager) Run(execution Execution) (models.Job, error) {
+	job, err := jobManager.Create(execution)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	return jobManager.Execute(job.ID, execution, nil), nil
+}
+
+// RunStep runs a workflow step as a job of its own, cancelled along with ctx.
+func (jobManager *JobManager) RunStep(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+	job, err := jobManager.Create(execution)
+	if err != nil {
+		return models.ApiResponse{
+			Success:  false,
+			Message:  err.Error(),
+			ExitCode: -1,
+		}
+	}
+
+	stopCancelling := context.AfterFunc(ctx, func() {
+		jobManager.Cancel(job.ID)
+	})
+	defer stopCancelling()
+
+	finishedJob := jobManager.Execute(job.ID, execution, listener)
+	if finishedJob.Result == nil {
+		return models.ApiResponse{
+			Success:   false,
+			Message:   "Job cancelled before start",
+			ExitCode:  -1,
+			Cancelled: true,
+		}
+	}
+
+	return *finishedJob.Result
+}
+
+func (jobManager *JobManager) MaxParallel() int {
+	return jobManager.maxParallel
+}
+
+func (jobManager *JobManager) Get(jobID string) (models.Job, bool) {
+	jobManager.mutex.RLock()
+	defer jobManager.mutex.RUnlock()
+
+	job, exists := jobManager.jobs[jobID]
+	if !exists {
+		return models.Job{}, false
+	}
+
+	return jobManager.snapshot(job), true
+}
+
+func (jobManager *JobManager) List() []models.Job {
+	jobManager.mutex.RLock()
+	defer jobManager.mutex.RUnlock()
+
+	jobs := make([]models.Job, 0, len(jobManager.jobs))
+	for _, job := range jobManager.jobs {
+		jobs = append(jobs, jobManager.snapshot(job))
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs
+}
+
+// Create queues a job for the execution, applying the action's concurrency
+// policy: reject fails with ErrActionBusy while another job of the action is
+// active, and replace cancels those jobs first. Rejected runs are recorded in
+// the history.
+func (jobManager *JobManager) Create(execution Execution) (models.Job, error) {
+	job, err := jobManager.queueJob(execution)
+	if errors.Is(err, ErrActionBusy) {
+		finishedAt := time.Now()
+		jobManager.recordHistory(models.Job{
+			ID:         job.ID,
+			Action:     execution.ActionName,
+			State:      models.JobRejected,
+			CreatedAt:  finishedAt,
+			FinishedAt: &finishedAt,
+			Result: &models.ApiResponse{
+				Success:  false,
+				Message:  err.Error(),
+				ExitCode: -1,
+			},
+		}, execution)
+	}
+
+	return job, err
+}
+
+func (jobManager *JobManager) queueJob(execution Execution) (models.Job, error) {
+	job := &models.Job{
+		ID:        generateJobID(),
+		Action:    execution.ActionName,
+		State:     models.JobQueued,
+		CreatedAt: time.Now(),
+	}
+
+	jobManager.mutex.Lock()
+	defer jobManager.mutex.Unlock()
+
+	switch execution.Action.Concurrency {
+	case models.ConcurrencyReject:
+		if jobManager.hasActiveJobs(execution.ActionName) {
+			return models.Job{ID: job.ID}, fmt.Errorf("%w: %s", ErrActionBusy, execution.ActionName)
+		}
+	case models.ConcurrencyReplace:
+		for _, activeJob := range jobManager.jobs {
+			if activeJob.Action == execution.ActionName && !activeJob.IsFinished() {
+				slog.Info("replacing job", "id", activeJob.ID, "action", activeJob.Action, "replacement", job.ID)
+				jobManager.cancel(activeJob)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slot := &jobSlot{
+		jobID:      job.ID,
+		actionName: execution.ActionName,
+		exclusive:  execution.Action.IsExclusive(),
+		counted:    !execution.Action.IsWorkflow(),
+		ready:      make(chan struct{}),
+	}
+
+	jobManager.jobs[job.ID] = job
+	jobManager.contexts[job.ID] = ctx
+	jobManager.cancels[job.ID] = cancel
+	jobManager.slots[job.ID] = slot
+	jobManager.queue = append(jobManager.queue, slot)
+	jobManager.pruneFinishedJobs()
+	jobManager.dispatch()
+
+	if !slot.granted {
+		slog.Info("job queued", "id", job.ID, "action", job.Action, "position", len(jobManager.queue))
+	}
+
+	return jobManager.snapshot(job), nil
+}
+
+func (jobManager *JobManager) Cancel(jobID string) (models.Job, error) {
+	jobManager.mutex.Lock()
+	defer jobManager.mutex.Unlock()
+
+	job, exists := jobManager.jobs[jobID]
+	if !exists {
+		return models.Job{}, ErrJobNotFound
+	}
+
+	if job.IsFinished() {
+		return *job, ErrJobFinished
+	}
+
+	jobManager.cancel(job)
+	return *job, nil
+}
+
+func (jobManager *JobManager) cancel(job *models.Job) {
+	if cancel, exists := jobManager.cancels[job.ID]; exists {
+		cancel()
+	}
+
+	if job.State == models.JobQueued {
+		finishedAt := time.Now()
+		job.State = models.JobCancelled
+		job.FinishedAt = &finishedAt
+		job.Result = &models.ApiResponse{
+			Success:   false,
+			Message:   "Job cancelled before start",
+			ExitCode:  -1,
+			Cancelled: true,
+		}
+		jobManager.removeFromQueue(job.ID)
+	}
+
+	slog.Info("job cancelled", "id", job.ID, "action", job.Action)
+}
+
+func (jobManager *JobManager) Execute(jobID string, execution Execution, listener OutputListener) models.Job {
+	defer jobManager.release(jobID)
+
+	ctx, started := jobManager.start(jobID)
+	if !started {
+		// A job cancelled while queued never ran, but is recorded all the same.
+		job, exists := jobManager.Get(jobID)
+		if exists && job.IsFinished() {
+			jobManager.recordHistory(job, execution)
+		}
+		return job
+	}
+
+	slog.Info("job started", "id", jobID, "action", execution.ActionName, "command", execution.Action.Command)
+
+	result := jobManager.executor.ExecuteStreaming(ctx, execution, listener)
+
+	// The finished job is copied while it is updated, since a later lookup
+	// can miss it once newer jobs have pruned it.
+	finishedAt := time.Now()
+	var finishedJob models.Job
+	jobManager.update(jobID, func(job *models.Job) {
+		job.State = jobStateFromResult(result)
+		job.FinishedAt = &finishedAt
+		job.Result = &result
+		finishedJob = *job
+	})
+
+	slog.Info("job finished",
+		"id", jobID,
+		"success", result.Success,
+		"exit_code", result.ExitCode,
+		"duration_ms", result.DurationMs)
+
+	entry := NewHistoryEntry(finishedJob, execution)
+	if execution.Source != SourceWorkflow {
+		jobManager.notifications.Notify(entry)
+	}
+	if err := jobManager.history.Append(entry); err != nil {
+		slog.Warn("failed to record history", "id", jobID, "error", err)
+	}
+
+	return finishedJob
+}
+
+// recordHistory records a job that finished without running.
+func (jobManager *JobManager) recordHistory(job models.Job, execution Execution) {
+	if err := jobManager.history.Append(NewHistoryEntry(job, execution)); err != nil {
+		slog.Warn("failed to record history", "id", job.ID, "error", err)
+	}
+}
+
+// start waits for the job's slot, or for the job to be cancelled while it
+// is still queued.
+func (jobManager *JobManager) start(jobID string) (context.Context, bool) {
+	jobManager.mutex.RLock()
+	slot, exists := jobManager.slots[jobID]
+	ctx := jobManager.contexts[jobID]
+	jobManager.mutex.RUnlock()
+	if !exists {
+		return nil, false
+	}
+
+	select {
+	case <-slot.ready:
+	case <-ctx.Done():
+	}
+
+	jobManager.mutex.Lock()
+	defer jobManager.mutex.Unlock()
+
+	job, exists := jobManager.jobs[jobID]
+	if !exists || job.State != models.JobQueued || !slot.granted {
+		return nil, false
+	}
+
+	startedAt := time.Now()
+	job.State = models.JobRunning
+	job.StartedAt = &startedAt
+
+	return jobManager.contexts[jobID], true
+}
+
+func (jobManager *JobManager) release(jobID string) {
+	jobManager.mutex.Lock()
+	defer jobManager.mutex.Unlock()
+
+	if cancel, exists := jobManager.cancels[jobID]; exists {
+		cancel()
+	}
+
+	delete(jobManager.contexts, jobID)
+	delete(jobManager.cancels, jobID)
+
+	slot, exists := jobManager.slots[jobID]
+	if !exists {
+		return
+	}
+
+	delete(jobManager.slots, jobID)
+	if !slot.granted {
+		jobManager.removeFromQueue(jobID)
+		return
+	}
+
+	if slot.counted {
+		jobManager.running--
+	}
+	jobManager.runningActions[slot.actionName]--
+	if jobManager.runningActions[slot.actionName] == 0 {
+		delete(jobManager.runningActions, slot.actionName)
+	}
+	jobManager.dispatch()
+}
+
+// dispatch starts queued jobs in order while the global limit allows. A job
+// waiting for its own action to finish does not hold back other actions.
+func (jobManager *JobManager) dispatch() {
+	waitingSlots := jobManager.queue[:0]
+	for _, slot := range jobManager.queue {
+		atLimit := slot.counted && jobManager.maxParallel > 0 && jobManager.running >= jobManager.maxParallel
+		actionBusy := slot.exclusive && jobManager.runningActions[slot.actionName] > 0
+		if atLimit || actionBusy {
+			waitingSlots = append(waitingSlots, slot)
+			continue
+		}
+
+		slot.granted = true
+		if slot.counted {
+			jobManager.running++
+		}
+		jobManager.runningActions[slot.actionName]++
+		close(slot.ready)
+	}
+
+	clear(jobManager.queue[len(waitingSlots):])
+	jobManager.queue = waitingSlots
+}
+
+func (jobManager *JobManager) removeFromQueue(jobID string) {
+	jobManager.queue = slices.DeleteFunc(jobManager.queue, func(slot *jobSlot) bool {
+		return slot.jobID == jobID
+	})
+}
+
+func (jobManager *JobManager) hasActiveJobs(actionName string) bool {
+	for _, job := range jobManager.jobs {
+		if job.Action == actionName && !job.IsFinished() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// snapshot copies a job, adding its position in the queue.
+func (jobManager *JobManager) snapshot(job *models.Job) models.Job {
+	snapshot := *job
+	if job.State == models.JobQueued {
+		for index, slot := range jobManager.queue {
+			if slot.jobID == job.ID {
+				snapshot.QueuePosition = index + 1
+				break
+			}
+		}
+	}
+
+	return snapshot
+}
+
+func (jobManager *JobManager) update(jobID string, mutate func(job *models.Job)) {
+	jobManager.mutex.Lock()
+	defer jobManager.mutex.Unlock()
+
+	if job, exists := jobManager.jobs[jobID]; exists {
+		mutate(job)
+	}
+}
+
+func (jobManager *JobManager) pruneFinishedJobs() {
+	var finishedJobs []*models.Job
+	for _, job := range jobManager.jobs {
+		if job.IsFinished() {
+			finishedJobs = append(finishedJobs, job)
+		}
+	}
+
+	if len(finishedJobs) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finishedJobs, func(i, j int) bool {
+		return finishedJobs[i].CreatedAt.Before(finishedJobs[j].CreatedAt)
+	})
+
+	for _, job := range finishedJobs[:len(finishedJobs)-maxFinishedJobs] {
+		delete(jobManager.jobs, job.ID)
+	}
+}
+
+func jobStateFromResult(result models.ApiResponse) models.JobState {
+	switch {
+	case result.Success:
+		return models.JobSucceeded
+	case result.Cancelled:
+		return models.JobCancelled
+	case result.TimedOut:
+		return models.JobTimedOut
+	default:
+		return models.JobFailed
+	}
+}
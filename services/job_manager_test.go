@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const jobStateWait = 5 * time.Second
+
+func newTestJobManager(t *testing.T, maxParallel int) (*JobManager, *HistoryStore) {
+	t.Helper()
+
+	history := NewHistoryStore(filepath.Join(t.TempDir(), "history.jsonl"))
+	return NewJobManager(NewExecutor(nil, NewValidator(), nil, nil), history, nil, maxParallel), history
+}
+
+func sleepingExecution(actionName string, concurrency models.ConcurrencyPolicy) Execution {
+	shell := false
+	return Execution{
+		ActionName: actionName,
+		Action: models.Action{
+			Command:     "sleep",
+			Args:        []string{"10"},
+			Shell:       &shell,
+			Concurrency: concurrency,
+		},
+		Source: SourceAPI,
+	}
+}
+
+// executeJob runs the job in the background and delivers it once finished.
+func executeJob(jobManager *JobManager, jobID string, execution Execution) <-chan models.Job {
+	finished := make(chan models.Job, 1)
+	go func() {
+		finished <- jobManager.Execute(jobID, execution, nil)
+	}()
+
+	return finished
+}
+
+func startJob(t *testing.T, jobManager *JobManager, execution Execution) (models.Job, <-chan models.Job) {
+	t.Helper()
+
+	job, err := jobManager.Create(execution)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	finished := executeJob(jobManager, job.ID, execution)
+	waitForJobState(t, jobManager, job.ID, models.JobRunning)
+	return job, finished
+}
+
+func waitForJobState(t *testing.T, jobManager *JobManager, jobID string, state models.JobState) {
+	t.Helper()
+
+	deadline := time.Now().Add(jobStateWait)
+	for time.Now().Before(deadline) {
+		if job, exists := jobManager.Get(jobID); exists && job.State == state {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	job, _ := jobManager.Get(jobID)
+	t.Fatalf("job %s did not reach state %s, last state %s", jobID, state, job.State)
+}
+
+func waitForJob(t *testing.T, finished <-chan models.Job) models.Job {
+	t.Helper()
+
+	select {
+	case job := <-finished:
+		return job
+	case <-time.After(jobStateWait):
+		t.Fatal("job did not finish")
+		return models.Job{}
+	}
+}
+
+// stopJob cancels a job that may already have finished and waits for it.
+func stopJob(t *testing.T, jobManager *JobManager, jobID string, finished <-chan models.Job) models.Job {
+	t.Helper()
+
+	if _, err := jobManager.Cancel(jobID); err != nil && !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return waitForJob(t, finished)
+}
+
+func historyStates(t *testing.T, history *HistoryStore, actionName string) []models.JobState {
+	t.Helper()
+
+	entries, err := history.Query(HistoryFilter{Action: actionName})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	states := make([]models.JobState, 0, len(entries))
+	for _, entry := range entries {
+		states = append(states, entry.Status)
+	}
+
+	return states
+}
+
+func TestJobManagerConcurrencyPolicies(t *testing.T) {
+	tests := []struct {
+		name              string
+		policy            models.ConcurrencyPolicy
+		err               error
+		queuePosition     int
+		firstStateOnQueue models.JobState
+	}{
+		{name: "allow runs alongside", policy: models.ConcurrencyAllow, firstStateOnQueue: models.JobRunning},
+		{name: "queue waits for the running job", policy: models.ConcurrencyQueue, queuePosition: 1, firstStateOnQueue: models.JobRunning},
+		{name: "reject fails while the action is busy", policy: models.ConcurrencyReject, err: ErrActionBusy, firstStateOnQueue: models.JobRunning},
+		{name: "replace cancels the running job", policy: models.ConcurrencyReplace, queuePosition: 1, firstStateOnQueue: models.JobCancelled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobManager, history := newTestJobManager(t, 0)
+			execution := sleepingExecution("backup", test.policy)
+
+			firstJob, firstFinished := startJob(t, jobManager, execution)
+
+			secondJob, err := jobManager.Create(execution)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if test.firstStateOnQueue == models.JobCancelled {
+				if finishedJob := waitForJob(t, firstFinished); finishedJob.State != models.JobCancelled {
+					t.Fatalf("expected the replaced job to be cancelled, got %s", finishedJob.State)
+				}
+			} else if job, _ := jobManager.Get(firstJob.ID); job.State != test.firstStateOnQueue {
+				t.Fatalf("expected the first job to be %s, got %s", test.firstStateOnQueue, job.State)
+			}
+
+			if err != nil {
+				stopJob(t, jobManager, firstJob.ID, firstFinished)
+
+				states := historyStates(t, history, "backup")
+				if len(states) != 2 || states[1] != models.JobRejected {
+					t.Fatalf("expected a rejected entry in history, got %v", states)
+				}
+				return
+			}
+
+			if secondJob.QueuePosition != test.queuePosition {
+				t.Fatalf("expected queue position %d, got %d", test.queuePosition, secondJob.QueuePosition)
+			}
+
+			secondFinished := executeJob(jobManager, secondJob.ID, execution)
+			if test.firstStateOnQueue != models.JobCancelled {
+				stopJob(t, jobManager, firstJob.ID, firstFinished)
+			}
+			stopJob(t, jobManager, secondJob.ID, secondFinished)
+		})
+	}
+}
+
+func TestJobManagerMaxParallel(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxParallel   int
+		queuePosition int
+	}{
+		{name: "unlimited", maxParallel: 0, queuePosition: 0},
+		{name: "limit reached", maxParallel: 1, queuePosition: 1},
+		{name: "limit not reached", maxParallel: 2, queuePosition: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobManager, _ := newTestJobManager(t, test.maxParallel)
+
+			firstJob, firstFinished := startJob(t, jobManager, sleepingExecution("backup", models.ConcurrencyAllow))
+
+			secondExecution := sleepingExecution("deploy", models.ConcurrencyAllow)
+			secondJob, err := jobManager.Create(secondExecution)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if secondJob.QueuePosition != test.queuePosition {
+				t.Fatalf("expected queue position %d, got %d", test.queuePosition, secondJob.QueuePosition)
+			}
+
+			secondFinished := executeJob(jobManager, secondJob.ID, secondExecution)
+			stopJob(t, jobManager, firstJob.ID, firstFinished)
+
+			// The queued job starts once the running one has released its slot.
+			waitForJobState(t, jobManager, secondJob.ID, models.JobRunning)
+			stopJob(t, jobManager, secondJob.ID, secondFinished)
+		})
+	}
+}
+
+func TestJobManagerCancelQueuedJob(t *testing.T) {
+	jobManager, history := newTestJobManager(t, 1)
+
+	firstJob, firstFinished := startJob(t, jobManager, sleepingExecution("backup", models.ConcurrencyAllow))
+
+	queuedExecution := sleepingExecution("deploy", models.ConcurrencyAllow)
+	queuedJob, err := jobManager.Create(queuedExecution)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nextExecution := sleepingExecution("report", models.ConcurrencyAllow)
+	nextJob, err := jobManager.Create(nextExecution)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if queuedJob.QueuePosition != 1 || nextJob.QueuePosition != 2 {
+		t.Fatalf("expected queue positions 1 and 2, got %d and %d", queuedJob.QueuePosition, nextJob.QueuePosition)
+	}
+
+	queuedFinished := executeJob(jobManager, queuedJob.ID, queuedExecution)
+	nextFinished := executeJob(jobManager, nextJob.ID, nextExecution)
+
+	cancelledJob := stopJob(t, jobManager, queuedJob.ID, queuedFinished)
+	if cancelledJob.State != models.JobCancelled || cancelledJob.Result == nil || !cancelledJob.Result.Cancelled {
+		t.Fatalf("expected a cancelled job with a result, got %+v", cancelledJob)
+	}
+
+	if job, _ := jobManager.Get(nextJob.ID); job.QueuePosition != 1 {
+		t.Fatalf("expected the next job to move up to position 1, got %d", job.QueuePosition)
+	}
+
+	if _, err := jobManager.Cancel(queuedJob.ID); !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("expected %v, got %v", ErrJobFinished, err)
+	}
+
+	if _, err := jobManager.Cancel("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected %v, got %v", ErrJobNotFound, err)
+	}
+
+	stopJob(t, jobManager, firstJob.ID, firstFinished)
+	waitForJobState(t, jobManager, nextJob.ID, models.JobRunning)
+	stopJob(t, jobManager, nextJob.ID, nextFinished)
+
+	if states := historyStates(t, history, "deploy"); len(states) != 1 || states[0] != models.JobCancelled {
+		t.Fatalf("expected a cancelled entry in history, got %v", states)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+)
+
+const maxPendingLineBytes = 64 * 1024
+
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+type OutputListener func(stream string, line string)
+
+type lineWriter struct {
+	stream   string
+	listener OutputListener
+	output   bytes.Buffer
+	pending  []byte
+}
+
+func newLineWriter(stream string, listener OutputListener) *lineWriter {
+	return &lineWriter{
+		stream:   stream,
+		listener: listener,
+	}
+}
+
+func (writer *lineWriter) Write(data []byte) (int, error) {
+	writer.output.Write(data)
+	if writer.listener == nil {
+		return len(data), nil
+	}
+
+	writer.pending = append(writer.pending, data...)
+	for {
+		newlineIndex := bytes.IndexByte(writer.pending, '\n')
+		if newlineIndex < 0 {
+			break
+		}
+
+		writer.emit(writer.pending[:newlineIndex])
+		writer.pending = writer.pending[newlineIndex+1:]
+	}
+
+	if len(writer.pending) > maxPendingLineBytes {
+		writer.Flush()
+	}
+
+	return len(data), nil
+}
+
+func (writer *lineWriter) Flush() {
+	if writer.listener == nil || len(writer.pending) == 0 {
+		return
+	}
+
+	writer.emit(writer.pending)
+	writer.pending = nil
+}
+
+func (writer *lineWriter) emit(line []byte) {
+	writer.listener(writer.stream, strings.TrimSuffix(string(line), "\r"))
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "dsw"
+
+type Metrics struct {
+	registry           *prometheus.Registry
+	executions         *prometheus.CounterVec
+	executionDurations *prometheus.HistogramVec
+	runningExecutions  *prometheus.GaugeVec
+	timeouts           *prometheus.CounterVec
+	httpRequests       *prometheus.CounterVec
+	reloads            *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		executions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "executions_total",
+			Help:      "Finished action executions by outcome.",
+		}, []string{"action", "outcome"}),
+		executionDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "execution_duration_seconds",
+			Help:      "Duration of finished action executions.",
+			Buckets:   []float64{0.05, 0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600},
+		}, []string{"action"}),
+		runningExecutions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "executions_running",
+			Help:      "Action executions currently running.",
+		}, []string{"action"}),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "execution_timeouts_total",
+			Help:      "Action executions killed for exceeding their timeout.",
+		}, []string{"action"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status code.",
+		}, []string{"route", "method", "status"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "configuration_reloads_total",
+			Help:      "Configuration reloads by result.",
+		}, []string{"result"}),
+	}
+
+	metrics.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.executions,
+		metrics.executionDurations,
+		metrics.runningExecutions,
+		metrics.timeouts,
+		metrics.httpRequests,
+		metrics.reloads,
+	)
+
+	return metrics
+}
+
+func (metrics *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+}
+
+func (metrics *Metrics) ExecutionStarted(actionName string) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.runningExecutions.WithLabelValues(actionName).Inc()
+}
+
+func (metrics *Metrics) ExecutionFinished(actionName string, result models.ApiResponse, duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.runningExecutions.WithLabelValues(actionName).Dec()
+	metrics.executions.WithLabelValues(actionName, string(jobStateFromResult(result))).Inc()
+	metrics.executionDurations.WithLabelValues(actionName).Observe(duration.Seconds())
+
+	if result.TimedOut {
+		metrics.timeouts.WithLabelValues(actionName).Inc()
+	}
+}
+
+func (metrics *Metrics) ReloadFinished(err error) {
+	if metrics == nil {
+		return
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	metrics.reloads.WithLabelValues(result).Inc()
+}
+
+// CountRequests labels requests with the chi route pattern rather than the
+// raw path, so action and job IDs do not create a series each.
+func (metrics *Metrics) CountRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		wrappedWriter := middleware.NewWrapResponseWriter(responseWriter, request.ProtoMajor)
+		next.ServeHTTP(wrappedWriter, request)
+
+		route := "unmatched"
+		if routeContext := chi.RouteContext(request.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+
+		status := wrappedWriter.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.httpRequests.WithLabelValues(route, request.Method, strconv.Itoa(status)).Inc()
+	})
+}
@@ -0,0 +1,594 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const (
+	notificationTimeout   = 10 * time.Second
+	defaultSMTPPort       = 587
+	implicitTLSSMTPPort   = 465
+	notificationStateRuns = 20
+)
+
+const defaultNotificationTitle = `dsw: {{.Action}} {{.Status}}`
+
+const defaultNotificationMessage = `{{.Message}}
+Exit code: {{.ExitCode}}, duration: {{.Duration}}{{with .Output}}
+
+{{tail 20 .}}{{end}}`
+
+var notificationFunctions = template.FuncMap{
+	"tail": tailLines,
+}
+
+// NotificationData is what title and message templates are rendered with.
+// Output holds the end of the run's output, as kept in the history.
+type NotificationData struct {
+	Condition  models.NotifyCondition
+	Action     string
+	JobID      string
+	Status     models.JobState
+	Success    bool
+	ExitCode   int
+	Duration   time.Duration
+	Message    string
+	Output     string
+	Source     string
+	Caller     string
+	Host       string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+type notification struct {
+	notifierName string
+	notifier     models.Notifier
+	data         NotificationData
+}
+
+// NotificationDispatcher matches finished runs against the configured
+// notifiers and delivers their messages in the background. It remembers the
+// last outcome of each action to detect recoveries, starting from the
+// history for actions it has not seen yet.
+type NotificationDispatcher struct {
+	mutex      sync.Mutex
+	history    *HistoryStore
+	notifiers  func() map[string]models.Notifier
+	lastStates map[string]models.JobState
+	httpClient *http.Client
+	pending    sync.WaitGroup
+}
+
+func NewNotificationDispatcher(history *HistoryStore, notifiers func() map[string]models.Notifier) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		history:    history,
+		notifiers:  notifiers,
+		lastStates: make(map[string]models.JobState),
+		httpClient: &http.Client{Timeout: notificationTimeout},
+	}
+}
+
+// Notify must be called before the entry is added to the history, so the
+// entry is not mistaken for the previous run of its action.
+func (dispatcher *NotificationDispatcher) Notify(entry models.HistoryEntry) {
+	if dispatcher == nil {
+		return
+	}
+
+	notifiers := dispatcher.notifiers()
+	if len(notifiers) == 0 {
+		return
+	}
+
+	previousState := dispatcher.recordState(entry)
+
+	for _, name := range sortedKeys(notifiers) {
+		notifier := notifiers[name]
+		if !isActionInScope(notifier.Actions, entry.Action) {
+			continue
+		}
+
+		condition, matched := matchNotifyCondition(notifier.Conditions(), entry.Status, previousState)
+		if !matched {
+			continue
+		}
+
+		dispatcher.pending.Add(1)
+		go func() {
+			defer dispatcher.pending.Done()
+			dispatcher.deliver(notification{
+				notifierName: name,
+				notifier:     notifier,
+				data:         newNotificationData(entry, condition),
+			})
+		}()
+	}
+}
+
+// Wait blocks until the notifications already dispatched are delivered or
+// have failed.
+func (dispatcher *NotificationDispatcher) Wait() {
+	if dispatcher == nil {
+		return
+	}
+
+	dispatcher.pending.Wait()
+}
+
+// recordState returns the previous outcome of the entry's action. Cancelled
+// runs are not outcomes, so they neither cause nor hide a recovery.
+func (dispatcher *NotificationDispatcher) recordState(entry models.HistoryEntry) models.JobState {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	previousState, known := dispatcher.lastStates[entry.Action]
+	if !known {
+		previousState = dispatcher.lastStateFromHistory(entry.Action)
+	}
+
+	if entry.Status != models.JobCancelled {
+		dispatcher.lastStates[entry.Action] = entry.Status
+	} else {
+		dispatcher.lastStates[entry.Action] = previousState
+	}
+
+	return previousState
+}
+
+func (dispatcher *NotificationDispatcher) lastStateFromHistory(actionName string) models.JobState {
+	entries, err := dispatcher.history.Query(HistoryFilter{Action: actionName, Limit: notificationStateRuns})
+	if err != nil {
+		slog.Warn("failed to read history for notifications", "action", actionName, "error", err)
+		return ""
+	}
+
+	for _, entry := range entries {
+		if entry.Status != models.JobCancelled && entry.Status != models.JobRejected {
+			return entry.Status
+		}
+	}
+
+	return ""
+}
+
+func matchNotifyCondition(conditions []models.NotifyCondition, state models.JobState, previousState models.JobState) (models.NotifyCondition, bool) {
+	for _, condition := range conditions {
+		if notifyConditionMet(condition, state, previousState) {
+			return condition, true
+		}
+	}
+
+	return "", false
+}
+
+func notifyConditionMet(condition models.NotifyCondition, state models.JobState, previousState models.JobState) bool {
+	switch condition {
+	case models.NotifyAlways:
+		return true
+	case models.NotifyFailure:
+		return isFailedState(state)
+	case models.NotifyTimeout:
+		return state == models.JobTimedOut
+	case models.NotifyRecovery:
+		return state == models.JobSucceeded && isFailedState(previousState)
+	default:
+		return false
+	}
+}
+
+func isFailedState(state models.JobState) bool {
+	return state == models.JobFailed || state == models.JobTimedOut
+}
+
+func newNotificationData(entry models.HistoryEntry, condition models.NotifyCondition) NotificationData {
+	host, _ := os.Hostname()
+
+	return NotificationData{
+		Condition:  condition,
+		Action:     entry.Action,
+		JobID:      entry.JobID,
+		Status:     entry.Status,
+		Success:    entry.Status == models.JobSucceeded,
+		ExitCode:   entry.ExitCode,
+		Duration:   (time.Duration(entry.DurationMs) * time.Millisecond).Round(time.Millisecond),
+		Message:    entry.Message,
+		Output:     entry.Output,
+		Source:     entry.Source,
+		Caller:     entry.Caller,
+		Host:       host,
+		StartedAt:  entry.StartedAt,
+		FinishedAt: entry.FinishedAt,
+	}
+}
+
+func (dispatcher *NotificationDispatcher) deliver(notification notification) {
+	title, message, err := renderNotification(notification.notifier, notification.data)
+
+	if err == nil {
+		switch notification.notifier.Type {
+		case models.NotifierWebhook:
+			err = dispatcher.sendWebhook(notification, title, message)
+		case models.NotifierNtfy:
+			err = dispatcher.sendNtfy(notification, title, message)
+		case models.NotifierGotify:
+			err = dispatcher.sendGotify(notification, title, message)
+		case models.NotifierSMTP:
+			err = sendMail(*notification.notifier.SMTP, title, message)
+		default:
+			err = fmt.Errorf("unknown notifier type: %s", notification.notifier.Type)
+		}
+	}
+
+	if err != nil {
+		slog.Warn("notification failed",
+			"notifier", notification.notifierName,
+			"action", notification.data.Action,
+			"job_id", notification.data.JobID,
+			"error", err)
+		return
+	}
+
+	slog.Info("notification sent",
+		"notifier", notification.notifierName,
+		"action", notification.data.Action,
+		"job_id", notification.data.JobID,
+		"condition", notification.data.Condition)
+}
+
+func renderNotification(notifier models.Notifier, data NotificationData) (string, string, error) {
+	titleTemplate, messageTemplate, err := parseNotificationTemplates(notifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	var title, message strings.Builder
+	if err := titleTemplate.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("failed to render title: %w", err)
+	}
+
+	if err := messageTemplate.Execute(&message, data); err != nil {
+		return "", "", fmt.Errorf("failed to render message: %w", err)
+	}
+
+	return strings.Join(strings.Fields(title.String()), " "), message.String(), nil
+}
+
+func parseNotificationTemplates(notifier models.Notifier) (*template.Template, *template.Template, error) {
+	titleSource := notifier.Title
+	if titleSource == "" {
+		titleSource = defaultNotificationTitle
+	}
+
+	messageSource := notifier.Message
+	if messageSource == "" {
+		messageSource = defaultNotificationMessage
+	}
+
+	titleTemplate, err := template.New("title").Funcs(notificationFunctions).Parse(titleSource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid title template: %w", err)
+	}
+
+	messageTemplate, err := template.New("message").Funcs(notificationFunctions).Parse(messageSource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid message template: %w", err)
+	}
+
+	return titleTemplate, messageTemplate, nil
+}
+
+// tailLines keeps the last count lines of text.
+func tailLines(count int, text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if count >= 0 && len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (dispatcher *NotificationDispatcher) sendWebhook(notification notification, title string, message string) error {
+	data := notification.data
+	payload, err := json.Marshal(map[string]interface{}{
+		"notifier":    notification.notifierName,
+		"condition":   data.Condition,
+		"title":       title,
+		"message":     message,
+		"action":      data.Action,
+		"job_id":      data.JobID,
+		"status":      data.Status,
+		"exit_code":   data.ExitCode,
+		"duration_ms": data.Duration.Milliseconds(),
+		"output":      data.Output,
+		"source":      data.Source,
+		"caller":      data.Caller,
+		"host":        data.Host,
+		"started_at":  data.StartedAt,
+		"finished_at": data.FinishedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	if notification.notifier.Token != "" {
+		headers["Authorization"] = "Bearer " + notification.notifier.Token
+	}
+
+	return dispatcher.post(notification.notifier.URL, payload, headers, notification.notifier.Headers)
+}
+
+// sendNtfy publishes to the topic URL, raising the priority of failures.
+func (dispatcher *NotificationDispatcher) sendNtfy(notification notification, title string, message string) error {
+	headers := map[string]string{
+		"Title":    mime.QEncoding.Encode("utf-8", title),
+		"Priority": "default",
+		"Tags":     "white_check_mark",
+	}
+	if !notification.data.Success {
+		headers["Priority"] = "high"
+		headers["Tags"] = "warning"
+	}
+
+	if notification.notifier.Token != "" {
+		headers["Authorization"] = "Bearer " + notification.notifier.Token
+	}
+
+	return dispatcher.post(notification.notifier.URL, []byte(message), headers, notification.notifier.Headers)
+}
+
+// sendGotify posts to the server's message endpoint with an application token.
+func (dispatcher *NotificationDispatcher) sendGotify(notification notification, title string, message string) error {
+	priority := 5
+	if !notification.data.Success {
+		priority = 8
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"title":    title,
+		"message":  message,
+		"priority": priority,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"X-Gotify-Key": notification.notifier.Token,
+	}
+
+	messageURL := strings.TrimSuffix(notification.notifier.URL, "/") + "/message"
+	return dispatcher.post(messageURL, payload, headers, notification.notifier.Headers)
+}
+
+// post sends body to targetURL. Headers configured on the notifier take
+// precedence over the ones set by its type.
+func (dispatcher *NotificationDispatcher) post(targetURL string, body []byte, headers map[string]string, customHeaders map[string]string) error {
+	request, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	for name, value := range customHeaders {
+		request.Header.Set(name, value)
+	}
+
+	response, err := dispatcher.httpClient.Do(request)
+	if err != nil {
+		var urlError *url.Error
+		if errors.As(err, &urlError) {
+			err = urlError.Err
+		}
+		return fmt.Errorf("request to %s failed: %w", redactURL(targetURL), err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status from %s: %s", redactURL(targetURL), response.Status)
+	}
+
+	return nil
+}
+
+// redactURL drops credentials and query strings, which may hold secrets,
+// before a URL is logged.
+func redactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "notifier URL"
+	}
+
+	parsedURL.User = nil
+	parsedURL.RawQuery = ""
+	return parsedURL.String()
+}
+
+// sendMail uses implicit TLS on port 465 and STARTTLS elsewhere when the
+// server offers it.
+func sendMail(settings models.SMTPSettings, subject string, body string) error {
+	port := settings.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+
+	address := net.JoinHostPort(settings.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: settings.Host}
+	dialer := &net.Dialer{Timeout: notificationTimeout}
+
+	var connection net.Conn
+	var err error
+	if port == implicitTLSSMTPPort {
+		connection, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		connection, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	connection.SetDeadline(time.Now().Add(notificationTimeout))
+
+	client, err := smtp.NewClient(connection, settings.Host)
+	if err != nil {
+		connection.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if port != implicitTLSSMTPPort {
+		if supported, _ := client.Extension("STARTTLS"); supported {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		}
+	}
+
+	if settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	sender, _ := mail.ParseAddress(settings.From)
+	if err := client.Mail(sender.Address); err != nil {
+		return fmt.Errorf("SMTP sender rejected: %w", err)
+	}
+
+	for _, recipient := range settings.To {
+		address, _ := mail.ParseAddress(recipient)
+		if err := client.Rcpt(address.Address); err != nil {
+			return fmt.Errorf("SMTP recipient %s rejected: %w", recipient, err)
+		}
+	}
+
+	dataWriter, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP data failed: %w", err)
+	}
+
+	if _, err := dataWriter.Write(buildMailMessage(settings, subject, body)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	if err := dataWriter.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func buildMailMessage(settings models.SMTPSettings, subject string, body string) []byte {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", settings.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(settings.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	message.WriteString("\r\n")
+
+	return message.Bytes()
+}
+
+// ValidateNotifier checks the settings required by the notifier's type and
+// parses its templates.
+func ValidateNotifier(notifier models.Notifier) error {
+	switch notifier.Type {
+	case models.NotifierWebhook, models.NotifierNtfy, models.NotifierGotify:
+		parsedURL, err := url.Parse(notifier.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return fmt.Errorf("invalid url %q (expected http:// or https://)", notifier.URL)
+		}
+
+		if notifier.Type == models.NotifierGotify && notifier.Token == "" {
+			return fmt.Errorf("gotify notifier requires an application token")
+		}
+
+		if notifier.SMTP != nil {
+			return fmt.Errorf("smtp settings only apply to smtp notifiers")
+		}
+	case models.NotifierSMTP:
+		if err := validateSMTPSettings(notifier.SMTP); err != nil {
+			return err
+		}
+
+		if notifier.URL != "" || notifier.Token != "" || len(notifier.Headers) > 0 {
+			return fmt.Errorf("url, token and headers do not apply to smtp notifiers")
+		}
+	default:
+		return fmt.Errorf("invalid notifier type %q (expected webhook, ntfy, gotify or smtp)", notifier.Type)
+	}
+
+	for _, condition := range notifier.On {
+		switch condition {
+		case models.NotifyAlways, models.NotifyFailure, models.NotifyTimeout, models.NotifyRecovery:
+		default:
+			return fmt.Errorf("invalid condition %q (expected always, failure, timeout or recovery)", condition)
+		}
+	}
+
+	if err := ValidateScopes(notifier.Actions); err != nil {
+		return fmt.Errorf("actions: %w", err)
+	}
+
+	_, _, err := parseNotificationTemplates(notifier)
+	return err
+}
+
+func validateSMTPSettings(settings *models.SMTPSettings) error {
+	if settings == nil || settings.Host == "" {
+		return fmt.Errorf("smtp notifier requires smtp.host")
+	}
+
+	if settings.Port < 0 || settings.Port > 65535 {
+		return fmt.Errorf("invalid smtp.port: %d", settings.Port)
+	}
+
+	if _, err := mail.ParseAddress(settings.From); err != nil {
+		return fmt.Errorf("invalid smtp.from %q: %w", settings.From, err)
+	}
+
+	if len(settings.To) == 0 {
+		return fmt.Errorf("smtp notifier requires at least one smtp.to address")
+	}
+
+	for _, recipient := range settings.To {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return fmt.Errorf("invalid smtp.to %q: %w", recipient, err)
+		}
+	}
+
+	if settings.Password != "" && settings.Username == "" {
+		return fmt.Errorf("smtp.password requires smtp.username")
+	}
+
+	return nil
+}
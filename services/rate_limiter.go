@@ -0,0 +1,196 @@
+package services
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const rateLimiterPruneInterval = time.Minute
+
+// RateLimiter keeps a token bucket and a cooldown deadline per key. Buckets
+// refill continuously and are dropped once full, since a full bucket behaves
+// like a new one.
+type RateLimiter struct {
+	mutex       sync.Mutex
+	buckets     map[string]*tokenBucket
+	cooldowns   map[string]time.Time
+	lastPruneAt time.Time
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		cooldowns: make(map[string]time.Time),
+	}
+}
+
+// Allow takes a token for key when both the rate limit and the cooldown
+// permit it, and otherwise reports how long to wait. The cooldown is only
+// checked here; StartCooldown begins it.
+func (rateLimiter *RateLimiter) Allow(key string, rateLimit *models.RateLimit) (bool, time.Duration) {
+	now := time.Now()
+
+	rateLimiter.mutex.Lock()
+	defer rateLimiter.mutex.Unlock()
+
+	rateLimiter.prune(now)
+
+	if cooldownEnd, exists := rateLimiter.cooldowns[key]; exists && now.Before(cooldownEnd) {
+		return false, cooldownEnd.Sub(now)
+	}
+
+	if rateLimit != nil {
+		refillRate := float64(rateLimit.Requests) / rateLimit.Per.Seconds()
+		burst := float64(rateLimit.BurstSize())
+
+		bucket, exists := rateLimiter.buckets[key]
+		if !exists {
+			bucket = &tokenBucket{tokens: burst, updatedAt: now}
+			rateLimiter.buckets[key] = bucket
+		}
+
+		bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*refillRate)
+		bucket.updatedAt = now
+
+		if bucket.tokens < 1 {
+			return false, time.Duration((1 - bucket.tokens) / refillRate * float64(time.Second))
+		}
+
+		bucket.tokens--
+		bucket.fullAt = now.Add(time.Duration((burst - bucket.tokens) / refillRate * float64(time.Second)))
+	}
+
+	return true, 0
+}
+
+func (rateLimiter *RateLimiter) StartCooldown(key string, cooldown time.Duration) {
+	if cooldown <= 0 {
+		return
+	}
+
+	rateLimiter.mutex.Lock()
+	defer rateLimiter.mutex.Unlock()
+
+	rateLimiter.cooldowns[key] = time.Now().Add(cooldown)
+}
+
+func (rateLimiter *RateLimiter) prune(now time.Time) {
+	if now.Sub(rateLimiter.lastPruneAt) < rateLimiterPruneInterval {
+		return
+	}
+	rateLimiter.lastPruneAt = now
+
+	for key, bucket := range rateLimiter.buckets {
+		if now.After(bucket.fullAt) {
+			delete(rateLimiter.buckets, key)
+		}
+	}
+
+	for key, cooldownEnd := range rateLimiter.cooldowns {
+		if now.After(cooldownEnd) {
+			delete(rateLimiter.cooldowns, key)
+		}
+	}
+}
+
+// limitAddresses applies the client rate limit per IP address to every TCP
+// request before it is authenticated, so that guessing tokens is throttled
+// too. Requests over the Unix socket come from the owner and are exempt.
+func (serverHandler *ServerHandler) limitAddresses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		clientRateLimit := serverHandler.Server.currentConfiguration().GetClientRateLimit()
+		if clientRateLimit == nil || isLocalConnection(request.Context()) {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+
+		if serverHandler.allowRequest(responseWriter, request, "client:ip:"+clientAddress(request), clientRateLimit) {
+			next.ServeHTTP(responseWriter, request)
+		}
+	})
+}
+
+// limitTokens applies the client rate limit per authenticated token, so that
+// a token shared between addresses is still limited as a whole.
+func (serverHandler *ServerHandler) limitTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		clientRateLimit := serverHandler.Server.currentConfiguration().GetClientRateLimit()
+		tokenName := tokenNameFromContext(request.Context())
+		if clientRateLimit == nil || tokenName == "" {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+
+		if serverHandler.allowRequest(responseWriter, request, "client:token:"+tokenName, clientRateLimit) {
+			next.ServeHTTP(responseWriter, request)
+		}
+	})
+}
+
+// createLimitedJob creates the job for an execution that passed
+// authentication and validation, applying the action's rate limit and
+// cooldown first, so requests that are rejected anyway cannot use up the
+// action's budget. The cooldown starts once the job exists. Admission is
+// serialized so that concurrent requests cannot slip through together.
+func (serverHandler *ServerHandler) createLimitedJob(responseWriter http.ResponseWriter, request *http.Request, execution Execution) (models.Job, bool) {
+	action := execution.Action
+	limited := action.RateLimit != nil || action.Cooldown > 0
+	actionKey := "action:" + execution.ActionName
+
+	if limited {
+		serverHandler.Server.admissionMutex.Lock()
+		defer serverHandler.Server.admissionMutex.Unlock()
+
+		if !serverHandler.allowRequest(responseWriter, request, actionKey, action.RateLimit) {
+			return models.Job{}, false
+		}
+	}
+
+	job, err := serverHandler.Server.jobs.Create(execution)
+	if err != nil {
+		serverHandler.Server.respondJobError(responseWriter, err)
+		return models.Job{}, false
+	}
+
+	serverHandler.Server.rateLimiter.StartCooldown(actionKey, action.Cooldown)
+	return job, true
+}
+
+func (serverHandler *ServerHandler) allowRequest(responseWriter http.ResponseWriter, request *http.Request, key string, rateLimit *models.RateLimit) bool {
+	allowed, retryAfter := serverHandler.Server.rateLimiter.Allow(key, rateLimit)
+	if allowed {
+		return true
+	}
+
+	slog.Warn("rate limit exceeded",
+		"key", key,
+		"path", request.URL.Path,
+		"remote", clientAddress(request),
+		"retry_after", retryAfter.Round(time.Millisecond))
+
+	responseWriter.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	serverHandler.Server.respondError(responseWriter, "rate limit exceeded, retry later", http.StatusTooManyRequests)
+	return false
+}
+
+func clientAddress(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return host
+}
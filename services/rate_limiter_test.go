@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name            string
+		rateLimit       *models.RateLimit
+		attempts        int
+		expectedAllowed int
+		maxRetryAfter   time.Duration
+	}{
+		{name: "no limit", attempts: 5, expectedAllowed: 5},
+		{name: "burst defaults to requests", rateLimit: &models.RateLimit{Requests: 3, Per: time.Hour}, attempts: 5, expectedAllowed: 3, maxRetryAfter: 20 * time.Minute},
+		{name: "smaller burst", rateLimit: &models.RateLimit{Requests: 3, Per: time.Hour, Burst: 1}, attempts: 5, expectedAllowed: 1, maxRetryAfter: 20 * time.Minute},
+		{name: "larger burst", rateLimit: &models.RateLimit{Requests: 1, Per: time.Hour, Burst: 4}, attempts: 5, expectedAllowed: 4, maxRetryAfter: time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rateLimiter := NewRateLimiter()
+
+			allowedCount := 0
+			var lastRetryAfter time.Duration
+			for range test.attempts {
+				allowed, retryAfter := rateLimiter.Allow("client", test.rateLimit)
+				if allowed {
+					allowedCount++
+					continue
+				}
+				lastRetryAfter = retryAfter
+			}
+
+			if allowedCount != test.expectedAllowed {
+				t.Fatalf("expected %d allowed requests, got %d", test.expectedAllowed, allowedCount)
+			}
+
+			if allowedCount < test.attempts && (lastRetryAfter <= 0 || lastRetryAfter > test.maxRetryAfter) {
+				t.Fatalf("expected retry after in (0, %s], got %s", test.maxRetryAfter, lastRetryAfter)
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	rateLimiter := NewRateLimiter()
+	rateLimit := &models.RateLimit{Requests: 1, Per: 50 * time.Millisecond}
+
+	if allowed, _ := rateLimiter.Allow("client", rateLimit); !allowed {
+		t.Fatal("expected the first request to be allowed")
+	}
+
+	if allowed, _ := rateLimiter.Allow("client", rateLimit); allowed {
+		t.Fatal("expected the second request to be limited")
+	}
+
+	if allowed, _ := rateLimiter.Allow("other", rateLimit); !allowed {
+		t.Fatal("expected another key to have a bucket of its own")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if allowed, _ := rateLimiter.Allow("client", rateLimit); !allowed {
+		t.Fatal("expected the bucket to refill")
+	}
+}
+
+func TestRateLimiterCooldown(t *testing.T) {
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		key      string
+		expected bool
+	}{
+		{name: "same key during cooldown", cooldown: time.Hour, key: "action:backup", expected: false},
+		{name: "other key", cooldown: time.Hour, key: "action:deploy", expected: true},
+		{name: "no cooldown", cooldown: 0, key: "action:backup", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rateLimiter := NewRateLimiter()
+			rateLimiter.StartCooldown("action:backup", test.cooldown)
+
+			allowed, retryAfter := rateLimiter.Allow(test.key, nil)
+			if allowed != test.expected {
+				t.Fatalf("expected allowed %v, got %v", test.expected, allowed)
+			}
+
+			if !allowed && (retryAfter <= time.Hour-time.Minute || retryAfter > time.Hour) {
+				t.Fatalf("expected retry after close to the cooldown, got %s", retryAfter)
+			}
+		})
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		remoteAddrs   []string
+		local         bool
+		expected      []int
+	}{
+		{
+			name:        "invalid tokens are limited per address",
+			remoteAddrs: []string{"192.0.2.1:1000", "192.0.2.1:1001", "192.0.2.1:1002"},
+			expected:    []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			name:        "addresses are limited separately",
+			remoteAddrs: []string{"192.0.2.1:1000", "192.0.2.1:1001", "192.0.2.2:1000"},
+			expected:    []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized},
+		},
+		{
+			name:          "a token is limited across addresses",
+			authorization: "Bearer " + testRawToken,
+			remoteAddrs:   []string{"192.0.2.1:1000", "192.0.2.2:1000", "192.0.2.3:1000"},
+			expected:      []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:        "unix socket is only limited as the local caller",
+			local:       true,
+			remoteAddrs: []string{"@", "@", "@"},
+			expected:    []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configuration := newTestConfiguration()
+			configuration.ClientRateLimit = &models.RateLimit{Requests: 2, Per: time.Hour}
+
+			serverHandler := newTestServerHandler(configuration)
+			handler := serverHandler.limitAddresses(serverHandler.authenticate(serverHandler.limitTokens(
+				http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+			)))
+
+			statuses := make([]int, 0, len(test.remoteAddrs))
+			for _, remoteAddr := range test.remoteAddrs {
+				request := httptest.NewRequest(http.MethodGet, "/actions", nil)
+				request.RemoteAddr = remoteAddr
+				if test.authorization != "" {
+					request.Header.Set("Authorization", test.authorization)
+				}
+				if test.local {
+					request = request.WithContext(context.WithValue(request.Context(), localConnectionContextKey, true))
+				}
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, request)
+				statuses = append(statuses, recorder.Code)
+
+				if recorder.Code == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") == "" {
+					t.Fatal("expected a Retry-After header")
+				}
+			}
+
+			if !slices.Equal(statuses, test.expected) {
+				t.Fatalf("expected statuses %v, got %v", test.expected, statuses)
+			}
+		})
+	}
+}
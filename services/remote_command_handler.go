@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+type RemoteCommandHandler struct {
+	apiClient *ApiClient
+	arguments []string
+}
+
+func NewRemoteCommandHandler(apiClient *ApiClient, arguments []string) *RemoteCommandHandler {
+	return &RemoteCommandHandler{
+		apiClient: apiClient,
+		arguments: arguments,
+	}
+}
+
+func (remoteCommandHandler *RemoteCommandHandler) List() {
+	listFlags := flag.NewFlagSet("list", flag.ExitOnError)
+	jsonOutput := listFlags.Bool("json", false, "Print actions as JSON")
+	listFlags.Parse(remoteCommandHandler.arguments[1:])
+
+	actions, err := remoteCommandHandler.apiClient.ListActions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to list actions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		printJSON(ActionsResponse{Actions: actions})
+		return
+	}
+
+	if len(actions) == 0 {
+		fmt.Println("No actions available")
+		return
+	}
+
+	fmt.Printf("%-24s %-6s %-8s %s\n", "NAME", "SHELL", "TIMEOUT", "COMMAND")
+	for _, name := range sortedKeys(actions) {
+		action := actions[name]
+		fmt.Printf("%-24s %-6t %-8s %s\n", name, action.UsesShell() && !action.IsWorkflow(), describeTimeout(action), describeCommand(action))
+	}
+}
+
+func (remoteCommandHandler *RemoteCommandHandler) Run() {
+	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
+	parameterValues := keyValueFlag{}
+	runFlags.Var(parameterValues, "param", "Parameter value KEY=VALUE (repeatable)")
+	jsonOutput := runFlags.Bool("json", false, "Print the result as JSON instead of streaming output")
+	async := runFlags.Bool("async", false, "Submit the action and print the job without waiting")
+	runFlags.Parse(remoteCommandHandler.arguments[1:])
+
+	if runFlags.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw --remote <url> run <name> [-param KEY=VALUE]... [-json] [-async]")
+		os.Exit(1)
+	}
+
+	actionName := runFlags.Arg(0)
+	runFlags.Parse(runFlags.Args()[1:])
+
+	runOnServer(remoteCommandHandler.apiClient, actionName, parameterValues, *jsonOutput, *async)
+}
+
+// runOnServer runs an action through a dsw server, streaming its output
+// unless JSON or async output is requested, and exits with its exit code.
+func runOnServer(apiClient *ApiClient, actionName string, parameters map[string]string, jsonOutput bool, async bool) {
+	if async {
+		job, err := apiClient.SubmitAction(actionName, parameters)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to submit action: %v\n", err)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			printJSON(job)
+			return
+		}
+
+		fmt.Printf("Job '%s' submitted for action '%s'\n", job.ID, job.Action)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var result models.ApiResponse
+	var err error
+	if jsonOutput {
+		result, err = apiClient.ExecuteAction(ctx, actionName, parameters)
+	} else {
+		result, err = streamAction(ctx, apiClient, actionName, parameters)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to run action: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		printJSON(result)
+	} else if !result.Success {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Message)
+	}
+
+	stop()
+	os.Exit(exitCodeOf(result))
+}
+
+// streamAction keeps reading the stream after an interrupt, so the cancelled
+// job still reports its final result.
+func streamAction(ctx context.Context, apiClient *ApiClient, actionName string, parameters map[string]string) (models.ApiResponse, error) {
+	var mutex sync.Mutex
+	var job models.Job
+	var result *models.ApiResponse
+
+	go func() {
+		<-ctx.Done()
+
+		mutex.Lock()
+		jobID := job.ID
+		finished := result != nil
+		mutex.Unlock()
+
+		if jobID == "" || finished {
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "Cancelling job '%s'...\n", jobID)
+		if _, err := apiClient.CancelJob(jobID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cancel job: %v\n", err)
+		}
+	}()
+
+	err := apiClient.StreamAction(context.Background(), actionName, parameters, func(event string, data string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch event {
+		case "job":
+			json.Unmarshal([]byte(data), &job)
+		case streamStdout:
+			fmt.Println(data)
+		case streamStderr:
+			fmt.Fprintln(os.Stderr, data)
+		case "result":
+			var finalResult models.ApiResponse
+			if err := json.Unmarshal([]byte(data), &finalResult); err == nil {
+				result = &finalResult
+			}
+		}
+	})
+	if err != nil {
+		return models.ApiResponse{}, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if result == nil {
+		return models.ApiResponse{}, fmt.Errorf("event stream ended without a result")
+	}
+
+	return *result, nil
+}
+
+func (remoteCommandHandler *RemoteCommandHandler) Jobs() {
+	jobsFlags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	jsonOutput := jobsFlags.Bool("json", false, "Print jobs as JSON")
+	jobsFlags.Parse(remoteCommandHandler.arguments[1:])
+
+	printJobs(remoteCommandHandler.apiClient, jobsFlags.Arg(0), *jsonOutput)
+}
+
+func printJobs(apiClient *ApiClient, jobID string, jsonOutput bool) {
+	if jobID != "" {
+		job, err := apiClient.GetJob(jobID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to get job: %v\n", err)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			printJSON(job)
+			return
+		}
+
+		printJob(job)
+		return
+	}
+
+	response, err := apiClient.ListJobs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to list jobs: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		printJSON(response)
+		return
+	}
+
+	if len(response.Jobs) == 0 {
+		fmt.Println("No jobs")
+		return
+	}
+
+	fmt.Printf("%-34s %-20s %-10s %-26s %s\n", "ID", "ACTION", "STATE", "CREATED", "DURATION")
+	for _, job := range response.Jobs {
+		fmt.Printf("%-34s %-20s %-10s %-26s %s\n",
+			job.ID,
+			job.Action,
+			formatJobState(job),
+			job.CreatedAt.Local().Format(time.RFC3339),
+			formatJobDuration(job))
+	}
+
+	fmt.Printf("\n%s\n", formatJobCounts(response))
+}
+
+func formatJobState(job models.Job) string {
+	if job.QueuePosition > 0 {
+		return fmt.Sprintf("%s (%d)", job.State, job.QueuePosition)
+	}
+
+	return string(job.State)
+}
+
+func formatJobCounts(response JobsResponse) string {
+	jobCounts := fmt.Sprintf("%d running, %d queued", response.Running, response.Queued)
+	if response.MaxParallel > 0 {
+		jobCounts += fmt.Sprintf(" (at most %d in parallel)", response.MaxParallel)
+	}
+
+	return jobCounts
+}
+
+func printJob(job models.Job) {
+	fmt.Printf("Job:      %s\n", job.ID)
+	fmt.Printf("Action:   %s\n", job.Action)
+	fmt.Printf("State:    %s\n", formatJobState(job))
+	fmt.Printf("Created:  %s\n", job.CreatedAt.Local().Format(time.RFC3339))
+	fmt.Printf("Started:  %s\n", formatOptionalTime(job.StartedAt))
+	fmt.Printf("Finished: %s\n", formatOptionalTime(job.FinishedAt))
+	fmt.Printf("Duration: %s\n", formatJobDuration(job))
+
+	if job.Result == nil {
+		return
+	}
+
+	fmt.Printf("Exit code: %d\n", job.Result.ExitCode)
+	fmt.Printf("Message:  %s\n", job.Result.Message)
+	if job.Result.Output != "" {
+		fmt.Println("Output:")
+		fmt.Println(job.Result.Output)
+	}
+}
+
+func formatJobDuration(job models.Job) string {
+	if job.Result != nil {
+		return (time.Duration(job.Result.DurationMs) * time.Millisecond).String()
+	}
+
+	if job.StartedAt != nil {
+		return time.Since(*job.StartedAt).Truncate(time.Second).String() + " (running)"
+	}
+
+	return "-"
+}
+
+func (remoteCommandHandler *RemoteCommandHandler) History() {
+	options := parseHistoryOptions(remoteCommandHandler.arguments[1:])
+
+	entries, err := remoteCommandHandler.apiClient.ListHistory(options.query())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read history: %v\n", err)
+		os.Exit(1)
+	}
+
+	printHistory(entries, options.jsonOutput)
+}
+
+type historyOptions struct {
+	action     string
+	status     string
+	since      string
+	limit      int
+	jsonOutput bool
+}
+
+func parseHistoryOptions(arguments []string) historyOptions {
+	var options historyOptions
+
+	historyFlags := flag.NewFlagSet("history", flag.ExitOnError)
+	historyFlags.StringVar(&options.action, "action", "", "Only show executions of this action")
+	historyFlags.StringVar(&options.status, "status", "", "Only show executions with this status (succeeded, failed, timed_out, cancelled, rejected)")
+	historyFlags.StringVar(&options.since, "since", "", "Only show executions started after a duration ago (24h) or an RFC 3339 time")
+	historyFlags.IntVar(&options.limit, "limit", defaultHistoryLimit, "Maximum number of executions to show")
+	historyFlags.BoolVar(&options.jsonOutput, "json", false, "Print executions as JSON")
+	historyFlags.Parse(arguments)
+
+	return options
+}
+
+func (options historyOptions) filter() (HistoryFilter, error) {
+	status, err := ParseHistoryStatus(options.status)
+	if err != nil {
+		return HistoryFilter{}, err
+	}
+
+	since, err := ParseHistorySince(options.since)
+	if err != nil {
+		return HistoryFilter{}, err
+	}
+
+	return HistoryFilter{
+		Action: options.action,
+		Status: status,
+		Since:  since,
+		Limit:  options.limit,
+	}, nil
+}
+
+func (options historyOptions) query() url.Values {
+	query := url.Values{}
+	if options.action != "" {
+		query.Set("action", options.action)
+	}
+	if options.status != "" {
+		query.Set("status", options.status)
+	}
+	if options.since != "" {
+		query.Set("since", options.since)
+	}
+	query.Set("limit", strconv.Itoa(options.limit))
+
+	return query
+}
+
+func printHistory(entries []models.HistoryEntry, jsonOutput bool) {
+	if jsonOutput {
+		printJSON(HistoryResponse{Entries: entries})
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No executions recorded")
+		return
+	}
+
+	fmt.Printf("%-26s %-20s %-10s %-5s %-10s %-10s %s\n", "STARTED", "ACTION", "STATUS", "EXIT", "DURATION", "SOURCE", "CALLER")
+	for _, entry := range entries {
+		caller := entry.Caller
+		if caller == "" {
+			caller = "-"
+		}
+
+		fmt.Printf("%-26s %-20s %-10s %-5d %-10s %-10s %s\n",
+			entry.StartedAt.Local().Format(time.RFC3339),
+			entry.Action,
+			entry.Status,
+			entry.ExitCode,
+			time.Duration(entry.DurationMs)*time.Millisecond,
+			entry.Source,
+			caller)
+	}
+}
+
+func (remoteCommandHandler *RemoteCommandHandler) Cancel() {
+	if len(remoteCommandHandler.arguments) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dsw --remote <url> cancel <job-id>")
+		os.Exit(1)
+	}
+
+	job, err := remoteCommandHandler.apiClient.CancelJob(remoteCommandHandler.arguments[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to cancel job: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Cancellation requested for job '%s' (action '%s')\n", job.ID, job.Action)
+}
+
+func (remoteCommandHandler *RemoteCommandHandler) Status() {
+	health, err := remoteCommandHandler.apiClient.Health()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Server:   %s (%s, v%s)\n", remoteCommandHandler.apiClient.BaseURL(), health.Status, health.Version)
+	printHealth(health)
+
+	response, err := remoteCommandHandler.apiClient.ListJobs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to list jobs: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Jobs:     %s\n", formatJobCounts(response))
+}
+
+func printHealth(health models.HealthStatus) {
+	fmt.Printf("Uptime:   %s\n", time.Duration(health.UptimeSeconds)*time.Second)
+	fmt.Printf("Actions:  %d (loaded %s)\n", health.Configuration.Actions, health.Configuration.LoadedAt.Local().Format(time.RFC3339))
+	fmt.Printf("Triggers: %d\n", health.Configuration.Triggers)
+
+	if health.Configuration.LastReloadError != "" {
+		fmt.Printf("Reload:   failed at %s: %s\n", formatOptionalTime(health.Configuration.LastReloadAt), health.Configuration.LastReloadError)
+	}
+}
+
+func printJSON(payload any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(payload); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to encode output: %v\n", err)
+		os.Exit(1)
+	}
+}
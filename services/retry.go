@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const (
+	maxRetryAttempts       = 100
+	defaultMaxRetryBackoff = time.Hour
+)
+
+// executeWithRetry runs attempts until one succeeds, the failure is not
+// retryable or the attempts run out. The action's timeout applies to each
+// attempt, and cancelling ctx ends the wait before the next one.
+func (executor *Executor) executeWithRetry(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+	retryPolicy := *execution.Action.Retry
+
+	var attempts []models.AttemptResult
+	var result models.ApiResponse
+	for attempt := 1; ; attempt++ {
+		result = executor.executeAttempt(ctx, execution, listener)
+		attempts = append(attempts, attemptResultOf(attempt, result))
+
+		if result.Success {
+			if attempt > 1 {
+				slog.Info("attempt succeeded", "action", execution.ActionName, "attempt", attempt, "attempts", retryPolicy.Attempts)
+			}
+			break
+		}
+
+		if attempt >= retryPolicy.Attempts || !isRetryable(retryPolicy, result) {
+			slog.Warn("attempt failed, not retrying",
+				"action", execution.ActionName,
+				"attempt", attempt,
+				"attempts", retryPolicy.Attempts,
+				"exit_code", result.ExitCode,
+				"timed_out", result.TimedOut,
+				"cancelled", result.Cancelled)
+			break
+		}
+
+		delay := retryDelay(retryPolicy, attempt)
+		slog.Warn("attempt failed, retrying",
+			"action", execution.ActionName,
+			"attempt", attempt,
+			"attempts", retryPolicy.Attempts,
+			"exit_code", result.ExitCode,
+			"timed_out", result.TimedOut,
+			"delay", delay.Round(time.Millisecond))
+
+		if !waitForRetry(ctx, delay) {
+			result = models.ApiResponse{
+				Success:   false,
+				Output:    result.Output,
+				Message:   "Command cancelled while waiting to retry",
+				ExitCode:  -1,
+				Cancelled: true,
+			}
+			break
+		}
+	}
+
+	if len(attempts) > 1 {
+		result.Message = fmt.Sprintf("%s (attempt %d of %d)", result.Message, len(attempts), retryPolicy.Attempts)
+	}
+	result.Attempts = attempts
+
+	return result
+}
+
+func attemptResultOf(attempt int, result models.ApiResponse) models.AttemptResult {
+	return models.AttemptResult{
+		Attempt:    attempt,
+		Success:    result.Success,
+		Output:     result.Output,
+		Message:    result.Message,
+		ExitCode:   result.ExitCode,
+		TimedOut:   result.TimedOut,
+		Cancelled:  result.Cancelled,
+		DurationMs: result.DurationMs,
+	}
+}
+
+func isRetryable(retryPolicy models.RetryPolicy, result models.ApiResponse) bool {
+	switch {
+	case result.Cancelled:
+		return false
+	case len(retryPolicy.ExitCodes) == 0 && !retryPolicy.OnTimeout:
+		return true
+	case result.TimedOut:
+		return retryPolicy.OnTimeout
+	default:
+		return slices.Contains(retryPolicy.ExitCodes, result.ExitCode)
+	}
+}
+
+// retryDelay returns the wait after the given attempt. Exponential backoff
+// doubles the delay after each attempt up to max_delay, an hour by default,
+// and jitter spreads it randomly by up to that fraction either way.
+func retryDelay(retryPolicy models.RetryPolicy, attempt int) time.Duration {
+	delay := retryPolicy.InitialDelay()
+
+	if retryPolicy.Backoff == models.BackoffExponential {
+		maxDelay := retryPolicy.MaxDelay
+		if maxDelay == 0 {
+			maxDelay = defaultMaxRetryBackoff
+		}
+
+		for doublings := 1; doublings < attempt && delay < maxDelay; doublings++ {
+			delay *= 2
+		}
+		delay = min(delay, maxDelay)
+	} else if retryPolicy.MaxDelay > 0 {
+		delay = min(delay, retryPolicy.MaxDelay)
+	}
+
+	if retryPolicy.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * retryPolicy.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+func waitForRetry(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func describeRetry(retryPolicy models.RetryPolicy) string {
+	backoff := retryPolicy.Backoff
+	if backoff == "" {
+		backoff = models.BackoffFixed
+	}
+
+	description := fmt.Sprintf("up to %d attempts, %s backoff from %s", retryPolicy.Attempts, backoff, retryPolicy.InitialDelay())
+	if retryPolicy.Jitter > 0 {
+		description += fmt.Sprintf(", %.0f%% jitter", retryPolicy.Jitter*100)
+	}
+
+	switch {
+	case len(retryPolicy.ExitCodes) > 0 && retryPolicy.OnTimeout:
+		description += fmt.Sprintf(", on exit codes %v or timeout", retryPolicy.ExitCodes)
+	case len(retryPolicy.ExitCodes) > 0:
+		description += fmt.Sprintf(", on exit codes %v", retryPolicy.ExitCodes)
+	case retryPolicy.OnTimeout:
+		description += ", on timeout only"
+	}
+
+	return description
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		retryPolicy models.RetryPolicy
+		attempt     int
+		expected    time.Duration
+	}{
+		{name: "fixed", retryPolicy: models.RetryPolicy{Delay: 2 * time.Second}, attempt: 3, expected: 2 * time.Second},
+		{name: "fixed capped by max delay", retryPolicy: models.RetryPolicy{Delay: 2 * time.Second, MaxDelay: time.Second}, attempt: 1, expected: time.Second},
+		{name: "exponential first attempt", retryPolicy: models.RetryPolicy{Backoff: models.BackoffExponential, Delay: time.Second}, attempt: 1, expected: time.Second},
+		{name: "exponential doubles", retryPolicy: models.RetryPolicy{Backoff: models.BackoffExponential, Delay: time.Second}, attempt: 4, expected: 8 * time.Second},
+		{name: "exponential capped by max delay", retryPolicy: models.RetryPolicy{Backoff: models.BackoffExponential, Delay: time.Second, MaxDelay: 5 * time.Second}, attempt: 4, expected: 5 * time.Second},
+		{name: "exponential capped by default", retryPolicy: models.RetryPolicy{Backoff: models.BackoffExponential, Delay: time.Minute}, attempt: 20, expected: defaultMaxRetryBackoff},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := retryDelay(test.retryPolicy, test.attempt); actual != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	retryPolicy := models.RetryPolicy{Delay: 10 * time.Second, Jitter: 0.2}
+
+	for range 100 {
+		if delay := retryDelay(retryPolicy, 1); delay < 8*time.Second || delay > 12*time.Second {
+			t.Fatalf("expected a delay within 20%% of 10s, got %s", delay)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name        string
+		retryPolicy models.RetryPolicy
+		result      models.ApiResponse
+		expected    bool
+	}{
+		{name: "any failure by default", result: models.ApiResponse{ExitCode: 1}, expected: true},
+		{name: "timeout by default", result: models.ApiResponse{ExitCode: -1, TimedOut: true}, expected: true},
+		{name: "cancelled", result: models.ApiResponse{ExitCode: -1, Cancelled: true}, expected: false},
+		{name: "listed exit code", retryPolicy: models.RetryPolicy{ExitCodes: []int{75}}, result: models.ApiResponse{ExitCode: 75}, expected: true},
+		{name: "unlisted exit code", retryPolicy: models.RetryPolicy{ExitCodes: []int{75}}, result: models.ApiResponse{ExitCode: 1}, expected: false},
+		{name: "timeout without on_timeout", retryPolicy: models.RetryPolicy{ExitCodes: []int{75}}, result: models.ApiResponse{ExitCode: -1, TimedOut: true}, expected: false},
+		{name: "timeout with on_timeout", retryPolicy: models.RetryPolicy{OnTimeout: true}, result: models.ApiResponse{ExitCode: -1, TimedOut: true}, expected: true},
+		{name: "exit code with on_timeout only", retryPolicy: models.RetryPolicy{OnTimeout: true}, result: models.ApiResponse{ExitCode: 1}, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := isRetryable(test.retryPolicy, test.result); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetry(t *testing.T) {
+	tests := []struct {
+		name             string
+		command          string
+		retryPolicy      models.RetryPolicy
+		expectedAttempts int
+		success          bool
+	}{
+		{name: "success needs one attempt", command: "true", retryPolicy: models.RetryPolicy{Attempts: 3}, expectedAttempts: 1, success: true},
+		{name: "failures use every attempt", command: "exit 75", retryPolicy: models.RetryPolicy{Attempts: 3}, expectedAttempts: 3},
+		{name: "listed exit code is retried", command: "exit 75", retryPolicy: models.RetryPolicy{Attempts: 2, ExitCodes: []int{75}}, expectedAttempts: 2},
+		{name: "other exit code is not retried", command: "exit 1", retryPolicy: models.RetryPolicy{Attempts: 3, ExitCodes: []int{75}}, expectedAttempts: 1},
+	}
+
+	executor := NewExecutor(nil, NewValidator(), nil, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retryPolicy := test.retryPolicy
+			retryPolicy.Delay = time.Millisecond
+
+			result := executor.Execute(context.Background(), Execution{
+				ActionName: "flaky",
+				Action:     models.Action{Command: test.command, Retry: &retryPolicy},
+			})
+
+			if result.Success != test.success {
+				t.Fatalf("expected success %v, got %v: %s", test.success, result.Success, result.Message)
+			}
+
+			if len(result.Attempts) != test.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", test.expectedAttempts, len(result.Attempts))
+			}
+
+			for index, attempt := range result.Attempts {
+				if attempt.Attempt != index+1 {
+					t.Fatalf("expected attempt %d to be numbered %d, got %d", index, index+1, attempt.Attempt)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetryCancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	executor := NewExecutor(nil, NewValidator(), nil, nil)
+	result := executor.Execute(ctx, Execution{
+		ActionName: "flaky",
+		Action:     models.Action{Command: "exit 1", Retry: &models.RetryPolicy{Attempts: 3, Delay: time.Hour}},
+	})
+
+	if !result.Cancelled || len(result.Attempts) != 1 {
+		t.Fatalf("expected a cancelled result after one attempt, got %+v", result)
+	}
+}
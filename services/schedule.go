@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+	"github.com/robfig/cron/v3"
+)
+
+const minimumInterval = time.Second
+
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (schedule intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(schedule.interval)
+}
+
+type zonedSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+func (schedule zonedSchedule) Next(after time.Time) time.Time {
+	return schedule.schedule.Next(after.In(schedule.location))
+}
+
+func ParseSchedule(trigger models.Trigger) (Schedule, error) {
+	hasCron := trigger.Cron != ""
+	hasInterval := trigger.Interval != 0
+
+	if hasCron == hasInterval {
+		return nil, fmt.Errorf("trigger needs exactly one of cron or interval")
+	}
+
+	if hasInterval {
+		if trigger.Timezone != "" {
+			return nil, fmt.Errorf("timezone only applies to cron triggers")
+		}
+
+		if trigger.Interval < minimumInterval {
+			return nil, fmt.Errorf("interval must be at least %s", minimumInterval)
+		}
+
+		return intervalSchedule{interval: trigger.Interval}, nil
+	}
+
+	location := time.Local
+	if trigger.Timezone != "" {
+		loadedLocation, err := time.LoadLocation(trigger.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", trigger.Timezone, err)
+		}
+		location = loadedLocation
+	}
+
+	cronSchedule, err := cronParser.Parse(trigger.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", trigger.Cron, err)
+	}
+
+	return zonedSchedule{schedule: cronSchedule, location: location}, nil
+}
+
+func isScheduled(trigger models.Trigger) bool {
+	return trigger.Cron != "" || trigger.Interval != 0
+}
+
+func describeSchedule(trigger models.Trigger) string {
+	if trigger.Interval != 0 {
+		return "every " + trigger.Interval.String()
+	}
+
+	if trigger.Timezone != "" {
+		return trigger.Cron + " (" + trigger.Timezone + ")"
+	}
+
+	return trigger.Cron
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+type Scheduler struct {
+	mutex        sync.RWMutex
+	runningMutex sync.Mutex
+	validator    *Validator
+	jobs         *JobManager
+	statuses     map[string]*models.ScheduleStatus
+	running      map[string]*runningTrigger
+}
+
+// runningTrigger is the loop of a scheduled or watch trigger. It keeps
+// running across configuration reloads while neither the trigger nor its
+// action changes.
+type runningTrigger struct {
+	trigger models.Trigger
+	action  models.Action
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newRunningTrigger(trigger models.Trigger, action models.Action) *runningTrigger {
+	return &runningTrigger{
+		trigger: trigger,
+		action:  action,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (running *runningTrigger) matches(trigger models.Trigger, action models.Action) bool {
+	return reflect.DeepEqual(running.trigger, trigger) && reflect.DeepEqual(running.action, action)
+}
+
+func (running *runningTrigger) halt() {
+	close(running.stop)
+	<-running.done
+}
+
+func NewScheduler(validator *Validator, jobs *JobManager) *Scheduler {
+	return &Scheduler{
+		validator: validator,
+		jobs:      jobs,
+		statuses:  make(map[string]*models.ScheduleStatus),
+		running:   make(map[string]*runningTrigger),
+	}
+}
+
+// Apply starts, restarts and stops scheduled triggers to match the
+// configuration. Unchanged triggers keep running, and a changed trigger
+// with the same schedule keeps its next run, so that frequent reloads do not
+// postpone interval triggers indefinitely.
+func (scheduler *Scheduler) Apply(configuration *Configuration) {
+	scheduler.runningMutex.Lock()
+	defer scheduler.runningMutex.Unlock()
+
+	triggers := configuration.ListTriggers()
+	stoppedTriggers := make(map[string]models.Trigger)
+
+	for triggerName, running := range scheduler.running {
+		trigger, exists := triggers[triggerName]
+		action, _ := configuration.GetAction(trigger.Action)
+		if exists && isScheduled(trigger) && running.matches(trigger, action) {
+			continue
+		}
+
+		running.halt()
+		delete(scheduler.running, triggerName)
+		stoppedTriggers[triggerName] = running.trigger
+	}
+
+	scheduler.mutex.Lock()
+	previousStatuses := scheduler.statuses
+	scheduler.statuses = make(map[string]*models.ScheduleStatus)
+	for triggerName := range scheduler.running {
+		scheduler.statuses[triggerName] = previousStatuses[triggerName]
+	}
+	scheduler.mutex.Unlock()
+
+	for triggerName, trigger := range triggers {
+		if _, running := scheduler.running[triggerName]; running || !isScheduled(trigger) {
+			continue
+		}
+
+		execution, schedule, err := scheduler.prepare(configuration, triggerName, trigger)
+		if err != nil {
+			slog.Error("skipping invalid trigger", "trigger", triggerName, "error", err)
+			continue
+		}
+
+		status := &models.ScheduleStatus{
+			Trigger:  triggerName,
+			Action:   trigger.Action,
+			Schedule: describeSchedule(trigger),
+		}
+
+		var nextRun time.Time
+		if previousStatus, exists := previousStatuses[triggerName]; exists {
+			status.LastRun = previousStatus.LastRun
+			status.LastJobID = previousStatus.LastJobID
+
+			previousTrigger, stopped := stoppedTriggers[triggerName]
+			if stopped && previousStatus.NextRun != nil && sameSchedule(previousTrigger, trigger) {
+				nextRun = *previousStatus.NextRun
+			}
+		}
+
+		scheduler.mutex.Lock()
+		scheduler.statuses[triggerName] = status
+		scheduler.mutex.Unlock()
+
+		running := newRunningTrigger(trigger, execution.Action)
+		scheduler.running[triggerName] = running
+		go scheduler.loop(triggerName, schedule, execution, running, nextRun)
+	}
+}
+
+func (scheduler *Scheduler) Stop() {
+	scheduler.runningMutex.Lock()
+	defer scheduler.runningMutex.Unlock()
+
+	for triggerName, running := range scheduler.running {
+		running.halt()
+		delete(scheduler.running, triggerName)
+	}
+}
+
+func sameSchedule(previousTrigger models.Trigger, trigger models.Trigger) bool {
+	return previousTrigger.Cron == trigger.Cron &&
+		previousTrigger.Timezone == trigger.Timezone &&
+		previousTrigger.Interval == trigger.Interval
+}
+
+func (scheduler *Scheduler) Statuses() []models.ScheduleStatus {
+	scheduler.mutex.RLock()
+	statuses := make([]models.ScheduleStatus, 0, len(scheduler.statuses))
+	for _, status := range scheduler.statuses {
+		statuses = append(statuses, *status)
+	}
+	scheduler.mutex.RUnlock()
+
+	for index, status := range statuses {
+		if job, exists := scheduler.jobs.Get(status.LastJobID); exists {
+			statuses[index].LastState = job.State
+		}
+	}
+
+	sortStatuses(statuses)
+	return statuses
+}
+
+func (scheduler *Scheduler) prepare(configuration *Configuration, triggerName string, trigger models.Trigger) (Execution, Schedule, error) {
+	action, exists := configuration.GetAction(trigger.Action)
+	if !exists {
+		return Execution{}, nil, fmt.Errorf("action not found: %s", trigger.Action)
+	}
+
+	schedule, err := ParseSchedule(trigger)
+	if err != nil {
+		return Execution{}, nil, err
+	}
+
+	parameters, err := scheduler.validator.ValidateParameters(action, trigger.Parameters)
+	if err != nil {
+		return Execution{}, nil, err
+	}
+
+	execution := Execution{
+		ActionName: trigger.Action,
+		Action:     action,
+		Parameters: parameters,
+		Source:     SourceSchedule,
+		Caller:     triggerName,
+	}
+
+	return execution, schedule, nil
+}
+
+// loop first runs at firstRun when it is set, and then follows the schedule.
+func (scheduler *Scheduler) loop(triggerName string, schedule Schedule, execution Execution, running *runningTrigger, firstRun time.Time) {
+	defer close(running.done)
+
+	for {
+		nextRun := firstRun
+		firstRun = time.Time{}
+		if nextRun.IsZero() {
+			nextRun = schedule.Next(time.Now())
+		}
+		scheduler.updateStatus(triggerName, func(status *models.ScheduleStatus) {
+			status.NextRun = &nextRun
+		})
+
+		timer := time.NewTimer(time.Until(nextRun))
+		select {
+		case <-running.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		slog.Info("running scheduled action", "trigger", triggerName, "action", execution.ActionName)
+
+		job, err := scheduler.jobs.Submit(execution)
+		if err != nil {
+			slog.Warn("skipping scheduled run", "trigger", triggerName, "error", err)
+			continue
+		}
+
+		lastRun := time.Now()
+		scheduler.updateStatus(triggerName, func(status *models.ScheduleStatus) {
+			status.LastRun = &lastRun
+			status.LastJobID = job.ID
+		})
+	}
+}
+
+func (scheduler *Scheduler) updateStatus(triggerName string, mutate func(status *models.ScheduleStatus)) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if status, exists := scheduler.statuses[triggerName]; exists {
+		mutate(status)
+	}
+}
+
+func PlanSchedules(configuration *Configuration) []models.ScheduleStatus {
+	now := time.Now()
+
+	var statuses []models.ScheduleStatus
+	for triggerName, trigger := range configuration.ListTriggers() {
+		if !isScheduled(trigger) {
+			continue
+		}
+
+		status := models.ScheduleStatus{
+			Trigger:  triggerName,
+			Action:   trigger.Action,
+			Schedule: describeSchedule(trigger),
+		}
+
+		if schedule, err := ParseSchedule(trigger); err == nil {
+			nextRun := schedule.Next(now)
+			status.NextRun = &nextRun
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sortStatuses(statuses)
+	return statuses
+}
+
+func sortStatuses(statuses []models.ScheduleStatus) {
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Trigger < statuses[j].Trigger
+	})
+}
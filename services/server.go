@@ -3,58 +3,150 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/albertoboccolini/dsw/models"
+	"github.com/fsnotify/fsnotify"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+const maxParameterBodyBytes = 64 * 1024
+
 type ServerHandler struct {
-	configuration *Configuration
-	Server        *Server
+	Server *Server
 }
 
-func NewServerHandler(configuration *Configuration, port int) *ServerHandler {
+func NewServerHandler(configuration *Configuration) (*ServerHandler, error) {
+	settings := configuration.GetServerSettings()
+	tlsConfig, err := ServerTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
 	router := chi.NewRouter()
+	metrics := NewMetrics()
 
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.RequestID)
+	router.Use(metrics.CountRequests)
 
-	server := &Server{
+	// Workflow steps use the configuration that is current when they run, and
+	// run as jobs of their own.
+	var server *Server
+	var jobs *JobManager
+	validator := NewValidator()
+	executor := NewExecutor(metrics, validator, func(name string) (models.Action, bool) {
+		return server.currentConfiguration().GetAction(name)
+	}, func(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+		return jobs.RunStep(ctx, execution, listener)
+	})
+	var history *HistoryStore
+	if historyPath, err := configuration.GetHistoryPath(); err != nil {
+		slog.Warn("execution history disabled", "error", err)
+	} else {
+		history = NewHistoryStore(historyPath)
+	}
+	notifications := NewNotificationDispatcher(history, func() map[string]models.Notifier {
+		return server.currentConfiguration().ListNotifiers()
+	})
+	jobs = NewJobManager(executor, history, notifications, settings.MaxParallel)
+
+	var socketPath string
+	if settings.Socket {
+		if socketPath, err = configuration.GetSocketPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	server = &Server{
 		router: router,
 		httpServer: &http.Server{
-			Addr:         fmt.Sprintf("0.0.0.0:%d", port),
+			Addr:         listenAddressOf(settings),
 			Handler:      router,
+			TLSConfig:    tlsConfig,
 			ReadTimeout:  10 * time.Second,
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  60 * time.Second,
+			ConnContext:  withConnectionContext,
 		},
-		executor: NewExecutor(),
+		socketPath:    socketPath,
+		rateLimiter:   NewRateLimiter(),
+		executor:      executor,
+		metrics:       metrics,
+		validator:     validator,
+		jobs:          jobs,
+		history:       history,
+		notifications: notifications,
+		scheduler:     NewScheduler(validator, jobs),
+		watcher:       NewFileWatcher(validator, jobs),
+		deliveries:    NewDeliveryCache(),
+		startedAt:     time.Now(),
 	}
+	server.configuration.Store(configuration)
+	server.recordConfigurationLoad(configuration)
 
 	serverHandler := &ServerHandler{
-		configuration: configuration,
-		Server:        server,
+		Server: server,
 	}
 
-	server.router.Get("/actions", serverHandler.handleListActions)
-	server.router.Post("/execute/{actionName}", serverHandler.handleExecuteAction)
+	server.router.With(serverHandler.limitAddresses).Post("/hooks/{actionName}", serverHandler.handleWebhook)
+	server.router.Get("/healthz", serverHandler.handleHealth)
+	server.router.Get("/readyz", serverHandler.handleReady)
+
+	server.router.Group(func(protected chi.Router) {
+		protected.Use(serverHandler.limitAddresses)
+		protected.Use(serverHandler.authenticate)
+		protected.Use(serverHandler.limitTokens)
+		protected.Get("/actions", serverHandler.handleListActions)
+		protected.Post("/execute/{actionName}", serverHandler.handleExecuteAction)
+		protected.Get("/execute/{actionName}/stream", serverHandler.handleStreamAction)
+		protected.Get("/jobs", serverHandler.handleListJobs)
+		protected.Get("/jobs/{jobID}", serverHandler.handleGetJob)
+		protected.Delete("/jobs/{jobID}", serverHandler.handleCancelJob)
+		protected.Get("/schedules", serverHandler.handleListSchedules)
+		protected.Get("/history", serverHandler.handleListHistory)
+		protected.With(serverHandler.authorizeMetrics).Handle("/metrics", metrics.Handler())
+	})
 
-	return serverHandler
+	return serverHandler, nil
 }
 
 type Server struct {
-	router     chi.Router
-	httpServer *http.Server
-	executor   *Executor
+	configuration        atomic.Pointer[Configuration]
+	configurationStatus  atomic.Pointer[models.ConfigurationStatus]
+	configurationWatcher *fsnotify.Watcher
+	reloadMutex          sync.Mutex
+	router               chi.Router
+	httpServer           *http.Server
+	socketPath           string
+	rateLimiter          *RateLimiter
+	admissionMutex       sync.Mutex
+	executor             *Executor
+	metrics              *Metrics
+	validator            *Validator
+	jobs                 *JobManager
+	history              *HistoryStore
+	notifications        *NotificationDispatcher
+	scheduler            *Scheduler
+	watcher              *FileWatcher
+	deliveries           *DeliveryCache
+	startedAt            time.Time
+	ready                atomic.Bool
 }
 
 type ErrorResponse struct {
@@ -66,8 +158,16 @@ type ActionsResponse struct {
 }
 
 func (serverHandler *ServerHandler) handleListActions(responseWriter http.ResponseWriter, request *http.Request) {
+	scopes := tokenScopesFromContext(request.Context())
+	visibleActions := make(map[string]models.Action)
+	for name, action := range serverHandler.Server.currentConfiguration().ListActions() {
+		if isActionInScope(scopes, name) {
+			visibleActions[name] = action
+		}
+	}
+
 	response := ActionsResponse{
-		Actions: serverHandler.configuration.Actions,
+		Actions: visibleActions,
 	}
 
 	responseWriter.Header().Set("Content-Type", "application/json")
@@ -78,35 +178,177 @@ func (serverHandler *ServerHandler) handleListActions(responseWriter http.Respon
 	}
 }
 
-func (serverHandler *ServerHandler) handleExecuteAction(responseWriter http.ResponseWriter, request *http.Request) {
+func (serverHandler *ServerHandler) resolveAction(responseWriter http.ResponseWriter, request *http.Request) (string, models.Action, bool) {
 	actionName := chi.URLParam(request, "actionName")
 
-	action, exists := serverHandler.configuration.GetAction(actionName)
+	if !isActionInScope(tokenScopesFromContext(request.Context()), actionName) {
+		slog.Warn("action outside token scope",
+			"name", actionName,
+			"token", tokenNameFromContext(request.Context()))
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("token not allowed to execute action: %s", actionName), http.StatusForbidden)
+		return "", models.Action{}, false
+	}
+
+	action, exists := serverHandler.Server.currentConfiguration().GetAction(actionName)
 	if !exists {
 		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("action not found: %s", actionName), http.StatusNotFound)
+		return "", models.Action{}, false
+	}
+
+	return actionName, action, true
+}
+
+func (serverHandler *ServerHandler) handleExecuteAction(responseWriter http.ResponseWriter, request *http.Request) {
+	if acceptsEventStream(request) {
+		serverHandler.handleStreamAction(responseWriter, request)
+		return
+	}
+
+	actionName, action, found := serverHandler.resolveAction(responseWriter, request)
+	if !found {
+		return
+	}
+
+	execution, valid := serverHandler.prepareExecution(responseWriter, request, actionName, action)
+	if !valid {
+		return
+	}
+
+	job, created := serverHandler.createLimitedJob(responseWriter, request, execution)
+	if !created {
 		return
 	}
 
 	slog.Info("executing action", "name", actionName, "command", action.Command)
 
-	result := serverHandler.Server.executor.Execute(action)
+	if isAsyncRequest(request) {
+		go serverHandler.Server.jobs.Execute(job.ID, execution, nil)
+		serverHandler.Server.respondAccepted(responseWriter, job)
+		return
+	}
+
+	// The command may run longer than the server write timeout.
+	if err := http.NewResponseController(responseWriter).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to extend write deadline", "error", err)
+	}
+
+	finishedJob := serverHandler.Server.jobs.Execute(job.ID, execution, nil)
+	responseWriter.Header().Set("X-Job-ID", job.ID)
+
+	// A job cancelled before it started has no result, only its state.
+	if finishedJob.ID == "" {
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("job not found: %s", job.ID), http.StatusInternalServerError)
+		return
+	}
+
+	if finishedJob.Result == nil {
+		serverHandler.Server.respondJSON(responseWriter, http.StatusInternalServerError, finishedJob)
+		return
+	}
+
+	serverHandler.Server.respondResult(responseWriter, *finishedJob.Result)
+}
+
+func (serverHandler *ServerHandler) prepareExecution(responseWriter http.ResponseWriter, request *http.Request, actionName string, action models.Action) (Execution, bool) {
+	values, err := parseParameterValues(request)
+	if err != nil {
+		serverHandler.Server.respondError(responseWriter, err.Error(), http.StatusBadRequest)
+		return Execution{}, false
+	}
+
+	parameters, err := serverHandler.Server.validator.ValidateParameters(action, values)
+	if err != nil {
+		serverHandler.Server.respondError(responseWriter, err.Error(), http.StatusBadRequest)
+		return Execution{}, false
+	}
+
+	return Execution{
+		ActionName: actionName,
+		Action:     action,
+		Parameters: parameters,
+		Source:     SourceAPI,
+		Caller:     tokenNameFromContext(request.Context()),
+		RequestID:  middleware.GetReqID(request.Context()),
+	}, true
+}
+
+func parseParameterValues(request *http.Request) (map[string]string, error) {
+	values := make(map[string]string)
+
+	if request.Body != nil && request.ContentLength != 0 {
+		decoder := json.NewDecoder(io.LimitReader(request.Body, maxParameterBodyBytes))
+		decoder.UseNumber()
+
+		var body map[string]any
+		if err := decoder.Decode(&body); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+
+		for name, rawValue := range body {
+			switch value := rawValue.(type) {
+			case nil:
+			case string:
+				values[name] = value
+			case json.Number:
+				values[name] = value.String()
+			case bool:
+				values[name] = strconv.FormatBool(value)
+			default:
+				return nil, fmt.Errorf("parameter %s must be a string, number or boolean", name)
+			}
+		}
+	}
+
+	for name, queryValues := range request.URL.Query() {
+		if slices.Contains(reservedParameterNames, name) {
+			continue
+		}
+
+		if _, duplicated := values[name]; duplicated || len(queryValues) > 1 {
+			return nil, fmt.Errorf("parameter %s given more than once", name)
+		}
+		values[name] = queryValues[0]
+	}
+
+	return values, nil
+}
+
+func isAsyncRequest(request *http.Request) bool {
+	async, err := strconv.ParseBool(request.URL.Query().Get("async"))
+	return err == nil && async
+}
 
-	slog.Info("action completed",
-		"name", actionName,
-		"success", result.Success,
-		"duration_ms", result.DurationMs)
+func (server *Server) respondAccepted(responseWriter http.ResponseWriter, job models.Job) {
+	responseWriter.Header().Set("Location", "/jobs/"+job.ID)
+	server.respondJSON(responseWriter, http.StatusAccepted, job)
+}
 
+func (server *Server) respondJSON(responseWriter http.ResponseWriter, statusCode int, payload any) {
 	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(statusCode)
 
+	if err := json.NewEncoder(responseWriter).Encode(payload); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+func (server *Server) respondResult(responseWriter http.ResponseWriter, result models.ApiResponse) {
 	statusCode := http.StatusOK
 	if !result.Success {
 		statusCode = http.StatusInternalServerError
 	}
-	responseWriter.WriteHeader(statusCode)
 
-	if err := json.NewEncoder(responseWriter).Encode(result); err != nil {
-		slog.Error("failed to encode result", "error", err)
+	server.respondJSON(responseWriter, statusCode, result)
+}
+
+func (server *Server) respondJobError(responseWriter http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+	if errors.Is(err, ErrActionBusy) {
+		statusCode = http.StatusConflict
 	}
+
+	slog.Warn("job rejected", "error", err)
+	server.respondError(responseWriter, err.Error(), statusCode)
 }
 
 func (server *Server) respondError(responseWriter http.ResponseWriter, message string, statusCode int) {
@@ -116,25 +358,104 @@ func (server *Server) respondError(responseWriter http.ResponseWriter, message s
 }
 
 func (server *Server) Start() error {
-	go func() {
-		slog.Info("starting server", "addr", server.httpServer.Addr)
+	server.applyTriggers(server.currentConfiguration())
 
-		if err := server.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("server error", "error", err)
-			os.Exit(1)
-		}
-	}()
+	if err := server.watchConfigurationFile(); err != nil {
+		slog.Warn("configuration hot reload disabled", "error", err)
+	}
 
+	tcpListener, socketListener, err := server.listen()
+	if err != nil {
+		server.stopConfigurationWatcher()
+		server.stopTriggers()
+		return err
+	}
+
+	// Serving the socket fills in TLSConfig for HTTP/2, so whether TCP uses
+	// TLS is decided before either listener starts.
+	useTLS := server.httpServer.TLSConfig != nil
+
+	if tcpListener != nil {
+		slog.Info("starting server",
+			"addr", server.httpServer.Addr,
+			"tls", useTLS,
+			"client_certificates", useTLS && server.httpServer.TLSConfig.ClientCAs != nil)
+
+		go server.serve(func() error {
+			if useTLS {
+				return server.httpServer.ServeTLS(tcpListener, "", "")
+			}
+			return server.httpServer.Serve(tcpListener)
+		})
+	}
+
+	if socketListener != nil {
+		slog.Info("starting server", "socket", server.socketPath)
+		go server.serve(func() error {
+			return server.httpServer.Serve(socketListener)
+		})
+	}
+
+	server.ready.Store(true)
 	server.waitForShutdown()
 	return nil
 }
 
+// listen binds every configured listener up front so that address conflicts
+// are reported before the server reports itself ready.
+func (server *Server) listen() (net.Listener, net.Listener, error) {
+	var tcpListener net.Listener
+	if server.httpServer.Addr != listenDisabled {
+		var err error
+		tcpListener, err = net.Listen("tcp", server.httpServer.Addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to listen on %s: %w", server.httpServer.Addr, err)
+		}
+	}
+
+	if server.socketPath == "" {
+		return tcpListener, nil, nil
+	}
+
+	socketListener, err := listenSocket(server.socketPath)
+	if err != nil {
+		if tcpListener != nil {
+			tcpListener.Close()
+		}
+		return nil, nil, err
+	}
+
+	return tcpListener, socketListener, nil
+}
+
+func (server *Server) serve(serveListener func() error) {
+	if err := serveListener(); err != nil && err != http.ErrServerClosed {
+		slog.Error("server error", "error", err)
+		os.Exit(1)
+	}
+}
+
 func (server *Server) waitForShutdown() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
-	<-quit
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	for waiting := true; waiting; {
+		select {
+		case <-reload:
+			slog.Info("received SIGHUP, reloading configuration")
+			server.ReloadConfiguration()
+		case <-quit:
+			waiting = false
+		}
+	}
+
 	slog.Info("shutting down server")
+	server.ready.Store(false)
+	server.stopConfigurationWatcher()
+	server.stopTriggers()
 
 	context, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -143,5 +464,7 @@ func (server *Server) waitForShutdown() {
 		slog.Error("server shutdown error", "error", err)
 	}
 
+	server.notifications.Wait()
+
 	slog.Info("server stopped")
 }
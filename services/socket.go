@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const listenDisabled = "none"
+const localCallerName = "local"
+const localConnectionContextKey contextKey = "localConnection"
+
+// withConnectionContext marks requests arriving on the Unix socket, which only
+// the owner of ~/.dsw can connect to.
+func withConnectionContext(ctx context.Context, connection net.Conn) context.Context {
+	if _, isUnix := connection.(*net.UnixConn); isUnix {
+		return context.WithValue(ctx, localConnectionContextKey, true)
+	}
+
+	return ctx
+}
+
+func isLocalConnection(ctx context.Context) bool {
+	local, _ := ctx.Value(localConnectionContextKey).(bool)
+	return local
+}
+
+func listenSocket(socketPath string) (net.Listener, error) {
+	if _, err := os.Stat(socketPath); err == nil {
+		if isSocketServing(socketPath) {
+			return nil, fmt.Errorf("another dsw server is listening on %s", socketPath)
+		}
+
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+func isSocketServing(socketPath string) bool {
+	connection, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return false
+	}
+
+	connection.Close()
+	return true
+}
+
+func describeListeners(configuration *Configuration) string {
+	settings := configuration.GetServerSettings()
+	addresses := []string{}
+	if listenAddress := listenAddressOf(settings); listenAddress != listenDisabled {
+		addresses = append(addresses, listenAddress)
+	}
+
+	if settings.Socket {
+		if socketPath, err := configuration.GetSocketPath(); err == nil {
+			addresses = append(addresses, socketPath)
+		}
+	}
+
+	return strings.Join(addresses, " and ")
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventStreamContentType = "text/event-stream"
+
+type eventStream struct {
+	mutex      sync.Mutex
+	writer     http.ResponseWriter
+	controller *http.ResponseController
+}
+
+func acceptsEventStream(request *http.Request) bool {
+	return strings.Contains(request.Header.Get("Accept"), eventStreamContentType)
+}
+
+func (stream *eventStream) send(event string, data string) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	fmt.Fprintf(stream.writer, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(stream.writer, "data: %s\n", line)
+	}
+	fmt.Fprint(stream.writer, "\n")
+
+	if err := stream.controller.Flush(); err != nil {
+		slog.Debug("failed to flush event stream", "error", err)
+	}
+}
+
+func (stream *eventStream) sendJSON(event string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("failed to encode event", "event", event, "error", err)
+		return
+	}
+
+	stream.send(event, string(data))
+}
+
+func (serverHandler *ServerHandler) handleStreamAction(responseWriter http.ResponseWriter, request *http.Request) {
+	actionName, action, found := serverHandler.resolveAction(responseWriter, request)
+	if !found {
+		return
+	}
+
+	execution, valid := serverHandler.prepareExecution(responseWriter, request, actionName, action)
+	if !valid {
+		return
+	}
+
+	job, created := serverHandler.createLimitedJob(responseWriter, request, execution)
+	if !created {
+		return
+	}
+
+	controller := http.NewResponseController(responseWriter)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to extend write deadline", "error", err)
+	}
+
+	responseWriter.Header().Set("Content-Type", eventStreamContentType)
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+	responseWriter.Header().Set("X-Accel-Buffering", "no")
+	responseWriter.Header().Set("X-Job-ID", job.ID)
+	responseWriter.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{
+		writer:     responseWriter,
+		controller: controller,
+	}
+
+	slog.Info("streaming action", "name", actionName, "job", job.ID, "command", action.Command)
+
+	stream.sendJSON("job", job)
+	finishedJob := serverHandler.Server.jobs.Execute(job.ID, execution, stream.send)
+	stream.sendJSON("result", finishedJob.Result)
+}
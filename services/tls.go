@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+const defaultListenAddress = "0.0.0.0:8080"
+
+func listenAddressOf(settings models.ServerSettings) string {
+	if settings.Listen != "" {
+		return settings.Listen
+	}
+
+	return defaultListenAddress
+}
+
+func ValidateListenAddress(address string) error {
+	if address == listenDisabled {
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: expected host:port or [ipv6]:port", address)
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("invalid listen port in %q", address)
+	}
+
+	return nil
+}
+
+// localBaseURL points local commands at the server, using loopback when it
+// listens on every interface.
+func localBaseURL(settings models.ServerSettings, port int) string {
+	host, listenPort, err := net.SplitHostPort(listenAddressOf(settings))
+	if err != nil {
+		host, listenPort = "", "8080"
+	}
+
+	if port > 0 {
+		listenPort = strconv.Itoa(port)
+	}
+
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+
+	scheme := "http"
+	if settings.UsesTLS() {
+		scheme = "https"
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, listenPort)
+}
+
+// describeListenAddress shows the configured TCP address with its scheme, or
+// that TCP is turned off.
+func describeListenAddress(settings models.ServerSettings, port int) string {
+	listenAddress := listenAddressOf(settings)
+	if listenAddress == listenDisabled {
+		return "none (Unix socket only)"
+	}
+
+	if port > 0 {
+		host, _, err := net.SplitHostPort(listenAddress)
+		if err == nil {
+			listenAddress = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+
+	if settings.UsesTLS() {
+		return "https://" + listenAddress
+	}
+
+	return "http://" + listenAddress
+}
+
+func ServerTLSConfig(settings models.ServerSettings) (*tls.Config, error) {
+	if !settings.UsesTLS() {
+		if settings.ClientCA != "" {
+			return nil, fmt.Errorf("client_ca requires tls_cert and tls_key")
+		}
+		return nil, nil
+	}
+
+	if settings.TLSCert == "" || settings.TLSKey == "" {
+		return nil, fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(settings.TLSCert, settings.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if settings.ClientCA != "" {
+		clientCAs, err := loadCertificatePool(settings.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if settings.LocalCert != "" || settings.LocalKey != "" {
+		if settings.ClientCA == "" {
+			return nil, fmt.Errorf("local_cert and local_key require client_ca")
+		}
+
+		if settings.LocalCert == "" || settings.LocalKey == "" {
+			return nil, fmt.Errorf("local_cert and local_key must be set together")
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// LocalClientTLSConfig trusts exactly the configured server certificate,
+// which is usually issued for a host name rather than the loopback address,
+// and presents the local client certificate when the server requires one.
+func LocalClientTLSConfig(settings models.ServerSettings) (*tls.Config, error) {
+	if !settings.UsesTLS() {
+		return nil, nil
+	}
+
+	certificateData, err := os.ReadFile(settings.TLSCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(certificateData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate found in %s", settings.TLSCert)
+	}
+	expectedCertificate := block.Bytes
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCertificates [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCertificates) == 0 || !bytes.Equal(rawCertificates[0], expectedCertificate) {
+				return fmt.Errorf("server certificate does not match %s", settings.TLSCert)
+			}
+			return nil
+		},
+	}
+
+	if settings.LocalCert != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.LocalCert, settings.LocalKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load local client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func ClientTLSConfig(profile models.RemoteProfile) (*tls.Config, error) {
+	if profile.CA == "" && profile.ClientCert == "" && profile.ClientKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if profile.CA != "" {
+		rootCAs, err := loadCertificatePool(profile.CA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if profile.ClientCert != "" || profile.ClientKey != "" {
+		if profile.ClientCert == "" || profile.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(profile.ClientCert, profile.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertificatePool(filePath string) (*x509.CertPool, error) {
+	certificateData, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	certificatePool := x509.NewCertPool()
+	if !certificatePool.AppendCertsFromPEM(certificateData) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", filePath)
+	}
+
+	return certificatePool, nil
+}
@@ -2,11 +2,25 @@ package services
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/albertoboccolini/dsw/models"
 )
 
+var environmentNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var reservedParameterNames = []string{"async"}
+
 type Validator struct{}
 
 func NewValidator() *Validator {
@@ -40,6 +54,485 @@ func (validator *Validator) ValidateCommand(commandPath string) error {
 	return nil
 }
 
+func (validator *Validator) ValidateAction(action models.Action) error {
+	if !action.IsWorkflow() {
+		if err := validator.ValidateCommand(action.Command); err != nil {
+			return err
+		}
+	}
+
+	return validator.validateActionSettings(action)
+}
+
+// validateActionSettings checks everything but whether the command is
+// installed, which depends on the machine rather than on the action.
+func (validator *Validator) validateActionSettings(action models.Action) error {
+	if action.IsWorkflow() {
+		if action.Command != "" || len(action.Args) > 0 {
+			return fmt.Errorf("workflow actions cannot have a command")
+		}
+
+		if err := validator.ValidateWorkflow(action.Workflow); err != nil {
+			return err
+		}
+	} else if action.Command == "" {
+		return fmt.Errorf("command cannot be empty")
+	}
+
+	if action.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative: %s", action.Timeout)
+	}
+
+	if action.Cooldown < 0 {
+		return fmt.Errorf("cooldown cannot be negative: %s", action.Cooldown)
+	}
+
+	if action.RateLimit != nil {
+		if err := validator.ValidateRateLimit(*action.RateLimit); err != nil {
+			return err
+		}
+	}
+
+	if action.Retry != nil {
+		if action.IsWorkflow() {
+			return fmt.Errorf("retry is not supported for workflows, set it on the actions of their steps")
+		}
+
+		if err := validator.ValidateRetryPolicy(*action.Retry); err != nil {
+			return err
+		}
+	}
+
+	switch action.Concurrency {
+	case "", models.ConcurrencyAllow, models.ConcurrencyReject, models.ConcurrencyQueue, models.ConcurrencyReplace:
+	default:
+		return fmt.Errorf("invalid concurrency policy: %s (use allow, reject, queue or replace)", action.Concurrency)
+	}
+
+	if err := validator.ValidateWorkDir(action.WorkDir); err != nil {
+		return err
+	}
+
+	for name := range action.Env {
+		if !environmentNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name: %q", name)
+		}
+	}
+
+	return validator.ValidateParameterDefinitions(action)
+}
+
+// ValidateWorkflow checks the shape of a workflow: unique step names, one
+// action or parallel group per step, edges to existing steps and no cycles.
+// The referenced actions are checked by ValidateWorkflowActions.
+func (validator *Validator) ValidateWorkflow(steps []models.WorkflowStep) error {
+	stepIndexes := make(map[string]int, len(steps))
+	for index, step := range steps {
+		if !isValidActionName(step.Name) || step.Name == models.WorkflowEnd {
+			return fmt.Errorf("invalid workflow step name: %q", step.Name)
+		}
+
+		if _, duplicated := stepIndexes[step.Name]; duplicated {
+			return fmt.Errorf("duplicate workflow step: %s", step.Name)
+		}
+		stepIndexes[step.Name] = index
+
+		if (step.Action == "") == (len(step.Parallel) == 0) {
+			return fmt.Errorf("step '%s' needs either action or parallel", step.Name)
+		}
+
+		if len(step.Parallel) > 0 && len(step.Params) > 0 {
+			return fmt.Errorf("step '%s': params are not supported for parallel steps", step.Name)
+		}
+
+		if step.Timeout < 0 {
+			return fmt.Errorf("step '%s': timeout cannot be negative: %s", step.Name, step.Timeout)
+		}
+	}
+
+	for _, step := range steps {
+		for _, target := range []string{step.OnSuccess, step.OnFailure} {
+			if _, exists := stepIndexes[target]; !exists && target != "" && target != models.WorkflowEnd {
+				return fmt.Errorf("step '%s' refers to unknown step: %s", step.Name, target)
+			}
+		}
+	}
+
+	return validateWorkflowOrder(steps, stepIndexes)
+}
+
+// validateWorkflowOrder rejects cycles, so every workflow terminates.
+func validateWorkflowOrder(steps []models.WorkflowStep, stepIndexes map[string]int) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(steps))
+
+	var visit func(index int) error
+	visit = func(index int) error {
+		switch states[index] {
+		case visiting:
+			return fmt.Errorf("workflow has a cycle through step '%s'", steps[index].Name)
+		case visited:
+			return nil
+		}
+
+		states[index] = visiting
+		for _, next := range workflowSuccessors(steps, stepIndexes, index) {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		states[index] = visited
+		return nil
+	}
+
+	for index := range steps {
+		if err := visit(index); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func workflowSuccessors(steps []models.WorkflowStep, stepIndexes map[string]int, index int) []int {
+	var successors []int
+	if next := nextWorkflowStep(steps, stepIndexes, index, true); next >= 0 {
+		successors = append(successors, next)
+	}
+	if next := nextWorkflowStep(steps, stepIndexes, index, false); next >= 0 {
+		successors = append(successors, next)
+	}
+
+	return successors
+}
+
+// ValidateWorkflows checks the step actions of every workflow in actions.
+func (validator *Validator) ValidateWorkflows(actions map[string]models.Action) error {
+	for _, name := range sortedKeys(actions) {
+		if err := validator.ValidateWorkflowActions(actions[name], actions); err != nil {
+			return fmt.Errorf("action '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateWorkflowActions checks that every step refers to an existing
+// command action and passes it valid parameters.
+func (validator *Validator) ValidateWorkflowActions(workflow models.Action, actions map[string]models.Action) error {
+	for _, step := range workflow.Workflow {
+		for _, actionName := range step.Actions() {
+			action, exists := actions[actionName]
+			if !exists {
+				return fmt.Errorf("step '%s': action not found: %s", step.Name, actionName)
+			}
+
+			if action.IsWorkflow() {
+				return fmt.Errorf("step '%s': action '%s' is a workflow, nested workflows are not supported", step.Name, actionName)
+			}
+
+			for name, value := range step.Params {
+				if _, declared := action.Parameters[name]; !declared {
+					return fmt.Errorf("step '%s': unknown parameter: %s", step.Name, name)
+				}
+
+				for _, placeholder := range placeholderNames(value) {
+					if _, declared := workflow.Parameters[placeholder]; !declared {
+						return fmt.Errorf("step '%s': parameter %s uses undeclared workflow parameter: %s", step.Name, name, placeholder)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (validator *Validator) ValidateParameterDefinitions(action models.Action) error {
+	for name, parameter := range action.Parameters {
+		if !parameterNamePattern.MatchString(name) || slices.Contains(reservedParameterNames, name) {
+			return fmt.Errorf("invalid parameter name: %q", name)
+		}
+
+		switch parameter.Type {
+		case models.ParameterString, models.ParameterInt, models.ParameterBool:
+		case models.ParameterEnum:
+			if len(parameter.Values) == 0 {
+				return fmt.Errorf("enum parameter %q must list its values", name)
+			}
+		default:
+			return fmt.Errorf("parameter %q has unknown type %q", name, parameter.Type)
+		}
+
+		if parameter.Min != nil && parameter.Max != nil && *parameter.Min > *parameter.Max {
+			return fmt.Errorf("parameter %q has min greater than max", name)
+		}
+
+		if parameter.Pattern != "" {
+			if _, err := compileParameterPattern(parameter.Pattern); err != nil {
+				return fmt.Errorf("parameter %q has invalid pattern: %w", name, err)
+			}
+		}
+
+		if parameter.Default != "" {
+			if _, err := validator.validateParameterValue(name, parameter, parameter.Default); err != nil {
+				return fmt.Errorf("invalid default: %w", err)
+			}
+		}
+	}
+
+	if len(placeholderNames(action.Command)) > 0 {
+		return fmt.Errorf("placeholders are only allowed in args")
+	}
+
+	for _, argument := range action.Args {
+		for _, name := range placeholderNames(argument) {
+			if _, declared := action.Parameters[name]; !declared {
+				return fmt.Errorf("placeholder {{%s}} references an undeclared parameter", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (validator *Validator) ValidateParameters(action models.Action, values map[string]string) (map[string]string, error) {
+	for name := range values {
+		if _, declared := action.Parameters[name]; !declared {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+
+	resolved := make(map[string]string, len(action.Parameters))
+	for name, parameter := range action.Parameters {
+		value, provided := values[name]
+		if !provided {
+			if parameter.Required {
+				return nil, fmt.Errorf("missing required parameter: %s", name)
+			}
+
+			if parameter.Default == "" {
+				resolved[name] = ""
+				continue
+			}
+			value = parameter.Default
+		}
+
+		normalizedValue, err := validator.validateParameterValue(name, parameter, value)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = normalizedValue
+	}
+
+	return resolved, nil
+}
+
+func (validator *Validator) validateParameterValue(name string, parameter models.Parameter, value string) (string, error) {
+	switch parameter.Type {
+	case models.ParameterInt:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("parameter %s must be an integer", name)
+		}
+
+		if parameter.Min != nil && number < *parameter.Min {
+			return "", fmt.Errorf("parameter %s must be at least %d", name, *parameter.Min)
+		}
+
+		if parameter.Max != nil && number > *parameter.Max {
+			return "", fmt.Errorf("parameter %s must be at most %d", name, *parameter.Max)
+		}
+
+		return strconv.Itoa(number), nil
+
+	case models.ParameterBool:
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("parameter %s must be a boolean", name)
+		}
+
+		return strconv.FormatBool(boolean), nil
+
+	case models.ParameterEnum:
+		if !slices.Contains(parameter.Values, value) {
+			return "", fmt.Errorf("parameter %s must be one of: %s", name, strings.Join(parameter.Values, ", "))
+		}
+
+		return value, nil
+
+	default:
+		length := utf8.RuneCountInString(value)
+		if parameter.Min != nil && length < *parameter.Min {
+			return "", fmt.Errorf("parameter %s must be at least %d characters", name, *parameter.Min)
+		}
+
+		if parameter.Max != nil && length > *parameter.Max {
+			return "", fmt.Errorf("parameter %s must be at most %d characters", name, *parameter.Max)
+		}
+
+		if parameter.Pattern != "" {
+			pattern, err := compileParameterPattern(parameter.Pattern)
+			if err != nil || !pattern.MatchString(value) {
+				return "", fmt.Errorf("parameter %s does not match pattern %s", name, parameter.Pattern)
+			}
+		}
+
+		return value, nil
+	}
+}
+
+func compileParameterPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+func (validator *Validator) ValidateWorkDir(workDir string) error {
+	if workDir == "" {
+		return nil
+	}
+
+	if !filepath.IsAbs(workDir) {
+		return fmt.Errorf("workdir must be an absolute path: %s", workDir)
+	}
+
+	fileInfo, err := os.Stat(workDir)
+	if err != nil {
+		return fmt.Errorf("cannot stat workdir: %w", err)
+	}
+
+	if !fileInfo.IsDir() {
+		return fmt.Errorf("workdir is not a directory: %s", workDir)
+	}
+
+	return nil
+}
+
+func (validator *Validator) ValidateTrigger(trigger models.Trigger, action models.Action) error {
+	if trigger.Watch != nil {
+		if isScheduled(trigger) {
+			return fmt.Errorf("trigger cannot combine watch with cron or interval")
+		}
+
+		if err := validator.ValidateWatch(*trigger.Watch, action); err != nil {
+			return err
+		}
+	} else if _, err := ParseSchedule(trigger); err != nil {
+		return err
+	}
+
+	if trigger.Watch != nil && trigger.Watch.Parameter != "" {
+		return nil
+	}
+
+	_, err := validator.ValidateParameters(action, trigger.Parameters)
+	return err
+}
+
+func (validator *Validator) ValidateWatch(watch models.Watch, action models.Action) error {
+	if len(watch.Paths) == 0 {
+		return fmt.Errorf("watch trigger needs at least one path")
+	}
+
+	for _, watchPath := range watch.Paths {
+		if _, err := parseWatchPath(watchPath); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range watch.Events {
+		if _, known := watchEventOperations[event]; !known {
+			return fmt.Errorf("unknown watch event %q: use create, write, remove, rename or chmod", event)
+		}
+	}
+
+	if watch.Debounce < 0 {
+		return fmt.Errorf("debounce cannot be negative: %s", watch.Debounce)
+	}
+
+	if watch.Parameter != "" {
+		parameter, declared := action.Parameters[watch.Parameter]
+		if !declared || parameter.Type != models.ParameterString {
+			return fmt.Errorf("watch parameter %q must be a string parameter of the action", watch.Parameter)
+		}
+	}
+
+	return nil
+}
+
+// ValidateConfiguration checks a whole configuration against the one it
+// replaces. A missing command only fails new or changed actions; for actions
+// unchanged from previous it is logged, so that uninstalling one binary does
+// not block unrelated edits.
+func (validator *Validator) ValidateConfiguration(configuration *Configuration, previous *Configuration) error {
+	actions := configuration.ListActions()
+	previousActions := previous.ListActions()
+
+	for name, action := range actions {
+		if !isValidActionName(name) {
+			return fmt.Errorf("invalid action name: %q", name)
+		}
+
+		if err := validator.validateActionSettings(action); err != nil {
+			return fmt.Errorf("action '%s': %w", name, err)
+		}
+
+		if action.IsWorkflow() {
+			continue
+		}
+
+		if err := validator.ValidateCommand(action.Command); err != nil {
+			previousAction, known := previousActions[name]
+			if !known || !reflect.DeepEqual(previousAction, action) {
+				return fmt.Errorf("action '%s': %w", name, err)
+			}
+			slog.Warn("command of unchanged action is unavailable", "action", name, "error", err)
+		}
+	}
+
+	if err := validator.ValidateWorkflows(actions); err != nil {
+		return err
+	}
+
+	for name, trigger := range configuration.ListTriggers() {
+		action, exists := actions[trigger.Action]
+		if !exists {
+			return fmt.Errorf("trigger '%s': action not found: %s", name, trigger.Action)
+		}
+
+		if err := validator.ValidateTrigger(trigger, action); err != nil {
+			return fmt.Errorf("trigger '%s': %w", name, err)
+		}
+	}
+
+	for name, token := range configuration.ListTokens() {
+		if err := ValidateScopes(token.Scopes); err != nil {
+			return fmt.Errorf("token '%s': %w", name, err)
+		}
+	}
+
+	if err := validator.ValidateServerSettings(configuration.GetServerSettings()); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+
+	if clientRateLimit := configuration.GetClientRateLimit(); clientRateLimit != nil {
+		if err := validator.ValidateRateLimit(*clientRateLimit); err != nil {
+			return fmt.Errorf("client_rate_limit: %w", err)
+		}
+	}
+
+	for name, notifier := range configuration.ListNotifiers() {
+		if err := ValidateNotifier(notifier); err != nil {
+			return fmt.Errorf("notifier '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
 func (validator *Validator) ParseCommandString(input string) (string, []string, error) {
 	if input == "" {
 		return "", nil, fmt.Errorf("command string is empty")
@@ -113,3 +606,66 @@ func (validator *Validator) splitCommand(input string) ([]string, error) {
 
 	return tokens, nil
 }
+
+func (validator *Validator) ValidateRateLimit(rateLimit models.RateLimit) error {
+	if rateLimit.Requests <= 0 || rateLimit.Per <= 0 {
+		return fmt.Errorf("rate limit needs positive requests and per values")
+	}
+
+	if rateLimit.Burst < 0 {
+		return fmt.Errorf("rate limit burst cannot be negative: %d", rateLimit.Burst)
+	}
+
+	return nil
+}
+
+func (validator *Validator) ValidateRetryPolicy(retryPolicy models.RetryPolicy) error {
+	if retryPolicy.Attempts < 1 || retryPolicy.Attempts > maxRetryAttempts {
+		return fmt.Errorf("retry attempts must be between 1 and %d: %d", maxRetryAttempts, retryPolicy.Attempts)
+	}
+
+	switch retryPolicy.Backoff {
+	case "", models.BackoffFixed, models.BackoffExponential:
+	default:
+		return fmt.Errorf("invalid retry backoff: %s (use fixed or exponential)", retryPolicy.Backoff)
+	}
+
+	if retryPolicy.Delay < 0 || retryPolicy.MaxDelay < 0 {
+		return fmt.Errorf("retry delays cannot be negative")
+	}
+
+	if retryPolicy.MaxDelay > 0 && retryPolicy.MaxDelay < retryPolicy.InitialDelay() {
+		return fmt.Errorf("retry max_delay %s is shorter than the delay %s", retryPolicy.MaxDelay, retryPolicy.InitialDelay())
+	}
+
+	if retryPolicy.Jitter < 0 || retryPolicy.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1: %g", retryPolicy.Jitter)
+	}
+
+	for _, exitCode := range retryPolicy.ExitCodes {
+		if exitCode < 1 || exitCode > 255 {
+			return fmt.Errorf("invalid retry exit code: %d (use 1-255)", exitCode)
+		}
+	}
+
+	return nil
+}
+
+func (validator *Validator) ValidateServerSettings(settings models.ServerSettings) error {
+	if settings.Listen != "" {
+		if err := ValidateListenAddress(settings.Listen); err != nil {
+			return err
+		}
+	}
+
+	if settings.MaxParallel < 0 {
+		return fmt.Errorf("max_parallel cannot be negative: %d", settings.MaxParallel)
+	}
+
+	if settings.Listen == listenDisabled && !settings.Socket {
+		return fmt.Errorf("listen %q requires the Unix socket to be enabled", listenDisabled)
+	}
+
+	_, err := ServerTLSConfig(settings)
+	return err
+}
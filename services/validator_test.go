@@ -0,0 +1,292 @@
+package services
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func TestValidateParameters(t *testing.T) {
+	action := models.Action{
+		Command: "echo",
+		Parameters: map[string]models.Parameter{
+			"name":    {Type: models.ParameterString, Required: true, Max: intPointer(8), Pattern: "[a-z]+"},
+			"count":   {Type: models.ParameterInt, Default: "3", Min: intPointer(1), Max: intPointer(10)},
+			"verbose": {Type: models.ParameterBool},
+			"level":   {Type: models.ParameterEnum, Values: []string{"full", "incremental"}, Default: "full"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected map[string]string
+		err      string
+	}{
+		{
+			name:     "defaults fill in missing values",
+			values:   map[string]string{"name": "photos"},
+			expected: map[string]string{"name": "photos", "count": "3", "verbose": "", "level": "full"},
+		},
+		{
+			name:     "values are normalized",
+			values:   map[string]string{"name": "photos", "count": "007", "verbose": "1", "level": "incremental"},
+			expected: map[string]string{"name": "photos", "count": "7", "verbose": "true", "level": "incremental"},
+		},
+		{
+			name:   "missing required parameter",
+			values: map[string]string{"count": "2"},
+			err:    "missing required parameter: name",
+		},
+		{
+			name:   "unknown parameter",
+			values: map[string]string{"name": "photos", "path": "/"},
+			err:    "unknown parameter: path",
+		},
+		{
+			name:   "integer below minimum",
+			values: map[string]string{"name": "photos", "count": "0"},
+			err:    "parameter count must be at least 1",
+		},
+		{
+			name:   "integer above maximum",
+			values: map[string]string{"name": "photos", "count": "11"},
+			err:    "parameter count must be at most 10",
+		},
+		{
+			name:   "integer that is not a number",
+			values: map[string]string{"name": "photos", "count": "3; rm -rf /"},
+			err:    "parameter count must be an integer",
+		},
+		{
+			name:   "invalid boolean",
+			values: map[string]string{"name": "photos", "verbose": "maybe"},
+			err:    "parameter verbose must be a boolean",
+		},
+		{
+			name:   "value outside enum",
+			values: map[string]string{"name": "photos", "level": "partial"},
+			err:    "parameter level must be one of: full, incremental",
+		},
+		{
+			name:   "string longer than maximum",
+			values: map[string]string{"name": "documents"},
+			err:    "parameter name must be at most 8 characters",
+		},
+		{
+			name:   "pattern matches the whole value",
+			values: map[string]string{"name": "ab$(id)"},
+			err:    "parameter name does not match pattern [a-z]+",
+		},
+	}
+
+	validator := NewValidator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := validator.ValidateParameters(action, test.values)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !maps.Equal(resolved, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, resolved)
+			}
+		})
+	}
+}
+
+func TestValidateParameterDefinitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		action models.Action
+		err    string
+	}{
+		{
+			name: "valid definitions",
+			action: models.Action{
+				Args:       []string{"--level={{level}}"},
+				Parameters: map[string]models.Parameter{"level": {Type: models.ParameterEnum, Values: []string{"full"}}},
+			},
+		},
+		{
+			name:   "reserved name",
+			action: models.Action{Parameters: map[string]models.Parameter{"async": {Type: models.ParameterBool}}},
+			err:    `invalid parameter name: "async"`,
+		},
+		{
+			name:   "unknown type",
+			action: models.Action{Parameters: map[string]models.Parameter{"size": {Type: "float"}}},
+			err:    `parameter "size" has unknown type "float"`,
+		},
+		{
+			name:   "enum without values",
+			action: models.Action{Parameters: map[string]models.Parameter{"level": {Type: models.ParameterEnum}}},
+			err:    `enum parameter "level" must list its values`,
+		},
+		{
+			name: "min greater than max",
+			action: models.Action{Parameters: map[string]models.Parameter{
+				"count": {Type: models.ParameterInt, Min: intPointer(5), Max: intPointer(1)},
+			}},
+			err: `parameter "count" has min greater than max`,
+		},
+		{
+			name: "default that fails its own checks",
+			action: models.Action{Parameters: map[string]models.Parameter{
+				"count": {Type: models.ParameterInt, Default: "many"},
+			}},
+			err: "invalid default: parameter count must be an integer",
+		},
+		{
+			name: "placeholder in command",
+			action: models.Action{
+				Command:    "{{tool}}",
+				Parameters: map[string]models.Parameter{"tool": {Type: models.ParameterString}},
+			},
+			err: "placeholders are only allowed in args",
+		},
+		{
+			name:   "placeholder for undeclared parameter",
+			action: models.Action{Args: []string{"{{path}}"}},
+			err:    "placeholder {{path}} references an undeclared parameter",
+		},
+	}
+
+	validator := NewValidator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.ValidateParameterDefinitions(test.action)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestBindArguments(t *testing.T) {
+	parameters := map[string]string{"name": "a b; rm -rf /", "count": "3"}
+
+	tests := []struct {
+		name               string
+		args               []string
+		expectedArgs       []string
+		expectedShellArgs  []string
+		expectedPositional []string
+	}{
+		{
+			name:               "whole arguments",
+			args:               []string{"{{name}}", "-n", "{{count}}"},
+			expectedArgs:       []string{"a b; rm -rf /", "-n", "3"},
+			expectedShellArgs:  []string{`"${1}"`, "-n", `"${2}"`},
+			expectedPositional: []string{"a b; rm -rf /", "3"},
+		},
+		{
+			name:               "repeated and embedded placeholders",
+			args:               []string{"--name={{name}}", "{{name}}"},
+			expectedArgs:       []string{"--name=a b; rm -rf /", "a b; rm -rf /"},
+			expectedShellArgs:  []string{`--name="${1}"`, `"${1}"`},
+			expectedPositional: []string{"a b; rm -rf /"},
+		},
+		{
+			name:              "arguments without placeholders",
+			args:              []string{"-v"},
+			expectedArgs:      []string{"-v"},
+			expectedShellArgs: []string{"-v"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if boundArgs := bindArguments(test.args, parameters); !slices.Equal(boundArgs, test.expectedArgs) {
+				t.Fatalf("expected args %q, got %q", test.expectedArgs, boundArgs)
+			}
+
+			shellArgs, positionalValues := bindShellArguments(test.args, parameters)
+			if !slices.Equal(shellArgs, test.expectedShellArgs) {
+				t.Fatalf("expected shell args %q, got %q", test.expectedShellArgs, shellArgs)
+			}
+
+			if !slices.Equal(positionalValues, test.expectedPositional) {
+				t.Fatalf("expected positional values %q, got %q", test.expectedPositional, positionalValues)
+			}
+		})
+	}
+}
+
+func TestValidateConfigurationMissingCommands(t *testing.T) {
+	shell := false
+	installed := models.Action{Command: "sh", Shell: &shell}
+	missing := models.Action{Command: "dsw-missing-command", Shell: &shell}
+	changedMissing := models.Action{Command: "dsw-missing-command", Args: []string{"-v"}, Shell: &shell}
+
+	tests := []struct {
+		name     string
+		previous map[string]models.Action
+		current  map[string]models.Action
+		err      string
+	}{
+		{
+			name:    "installed command",
+			current: map[string]models.Action{"backup": installed},
+		},
+		{
+			name:    "new action with a missing command",
+			current: map[string]models.Action{"backup": missing},
+			err:     "action 'backup': command not found in PATH: dsw-missing-command",
+		},
+		{
+			name:     "unchanged action with a missing command",
+			previous: map[string]models.Action{"backup": missing},
+			current:  map[string]models.Action{"backup": missing, "other": installed},
+		},
+		{
+			name:     "changed action with a missing command",
+			previous: map[string]models.Action{"backup": missing},
+			current:  map[string]models.Action{"backup": changedMissing},
+			err:      "action 'backup': command not found in PATH: dsw-missing-command",
+		},
+	}
+
+	validator := NewValidator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := NewConfiguration()
+			maps.Copy(previous.Actions, test.previous)
+			current := NewConfiguration()
+			maps.Copy(current.Actions, test.current)
+
+			err := validator.ValidateConfiguration(current, previous)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
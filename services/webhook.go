@@ -0,0 +1,209 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/albertoboccolini/dsw/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const maxWebhookPayloadBytes = 1 << 20
+const deliveryRetention = 24 * time.Hour
+const branchRefPrefix = "refs/heads/"
+
+var signatureHeaders = []string{"X-Hub-Signature-256", "X-Gitea-Signature", "X-Forgejo-Signature"}
+var deliveryHeaders = []string{"X-GitHub-Delivery", "X-Gitea-Delivery", "X-Forgejo-Delivery"}
+var eventHeaders = []string{"X-GitHub-Event", "X-Gitea-Event", "X-Forgejo-Event"}
+
+// DeliveryCache remembers the payloads delivered in the last
+// deliveryRetention. Delivery headers are not covered by the signature, so
+// payloads are recognised by their digest instead. The cache lives in memory
+// and is empty again after a restart.
+type DeliveryCache struct {
+	mutex      sync.Mutex
+	deliveries map[string]time.Time
+}
+
+func NewDeliveryCache() *DeliveryCache {
+	return &DeliveryCache{
+		deliveries: make(map[string]time.Time),
+	}
+}
+
+func deliveryKey(actionName string, payload []byte) string {
+	digest := sha256.Sum256(payload)
+	return actionName + ":" + hex.EncodeToString(digest[:])
+}
+
+func (deliveryCache *DeliveryCache) Remember(key string) bool {
+	deliveryCache.mutex.Lock()
+	defer deliveryCache.mutex.Unlock()
+
+	now := time.Now()
+	for id, receivedAt := range deliveryCache.deliveries {
+		if now.Sub(receivedAt) > deliveryRetention {
+			delete(deliveryCache.deliveries, id)
+		}
+	}
+
+	if _, seen := deliveryCache.deliveries[key]; seen {
+		return false
+	}
+
+	deliveryCache.deliveries[key] = now
+	return true
+}
+
+func (deliveryCache *DeliveryCache) Forget(key string) {
+	deliveryCache.mutex.Lock()
+	defer deliveryCache.mutex.Unlock()
+
+	delete(deliveryCache.deliveries, key)
+}
+
+type webhookPayload struct {
+	Ref string `json:"ref"`
+}
+
+func firstHeader(request *http.Request, names []string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(request.Header.Get(name)); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func verifySignature(secret string, payload []byte, signature string) bool {
+	signature = strings.TrimPrefix(signature, "sha256=")
+
+	expectedSignature, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expectedSignature)
+}
+
+func matchesBranch(branches []string, ref string) bool {
+	branch, isBranch := strings.CutPrefix(ref, branchRefPrefix)
+	if !isBranch {
+		return false
+	}
+
+	for _, pattern := range branches {
+		if matched, err := path.Match(pattern, branch); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (serverHandler *ServerHandler) handleWebhook(responseWriter http.ResponseWriter, request *http.Request) {
+	actionName := chi.URLParam(request, "actionName")
+
+	action, exists := serverHandler.Server.currentConfiguration().GetAction(actionName)
+	if !exists || action.Webhook == nil || action.Webhook.Secret == "" {
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("webhook not found: %s", actionName), http.StatusNotFound)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(responseWriter, request.Body, maxWebhookPayloadBytes))
+	if err != nil {
+		serverHandler.Server.respondError(responseWriter, "payload too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	signature := firstHeader(request, signatureHeaders)
+	if signature == "" || !verifySignature(action.Webhook.Secret, payload, signature) {
+		slog.Warn("rejected webhook with invalid signature", "name", actionName, "remote", request.RemoteAddr)
+		serverHandler.Server.respondError(responseWriter, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	deliveryID := firstHeader(request, deliveryHeaders)
+	if deliveryID == "" {
+		serverHandler.Server.respondError(responseWriter, "missing delivery id", http.StatusBadRequest)
+		return
+	}
+
+	payloadKey := deliveryKey(actionName, payload)
+	if !serverHandler.Server.deliveries.Remember(payloadKey) {
+		slog.Warn("rejected replayed webhook", "name", actionName, "delivery", deliveryID)
+		serverHandler.Server.respondError(responseWriter, fmt.Sprintf("payload already delivered: %s", deliveryID), http.StatusConflict)
+		return
+	}
+
+	event := firstHeader(request, eventHeaders)
+	if event == "ping" {
+		serverHandler.Server.respondResult(responseWriter, models.ApiResponse{Success: true, Message: "pong"})
+		return
+	}
+
+	if len(action.Webhook.Events) > 0 && !slices.Contains(action.Webhook.Events, event) {
+		serverHandler.Server.respondResult(responseWriter, models.ApiResponse{
+			Success: true,
+			Message: fmt.Sprintf("Event '%s' ignored", event),
+		})
+		return
+	}
+
+	if len(action.Webhook.Branches) > 0 {
+		var parsedPayload webhookPayload
+		if err := json.Unmarshal(payload, &parsedPayload); err != nil {
+			serverHandler.Server.respondError(responseWriter, "invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+
+		if !matchesBranch(action.Webhook.Branches, parsedPayload.Ref) {
+			serverHandler.Server.respondResult(responseWriter, models.ApiResponse{
+				Success: true,
+				Message: fmt.Sprintf("Ref '%s' ignored", parsedPayload.Ref),
+			})
+			return
+		}
+	}
+
+	parameters, err := serverHandler.Server.validator.ValidateParameters(action, nil)
+	if err != nil {
+		serverHandler.Server.respondError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	execution := Execution{
+		ActionName: actionName,
+		Action:     action,
+		Parameters: parameters,
+		Source:     SourceWebhook,
+		RequestID:  middleware.GetReqID(request.Context()),
+	}
+
+	// A delivery that is not run can be redelivered later.
+	job, created := serverHandler.createLimitedJob(responseWriter, request, execution)
+	if !created {
+		serverHandler.Server.deliveries.Forget(payloadKey)
+		return
+	}
+
+	slog.Info("executing webhook action", "name", actionName, "event", event, "delivery", deliveryID)
+
+	go serverHandler.Server.jobs.Execute(job.ID, execution, nil)
+	serverHandler.Server.respondAccepted(responseWriter, job)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/dsw/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const testWebhookSecret = "s3cret"
+
+func signPayload(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := `{"ref":"refs/heads/main"}`
+	signature := signPayload(testWebhookSecret, payload)
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   string
+		signature string
+		expected  bool
+	}{
+		{name: "github style prefix", secret: testWebhookSecret, payload: payload, signature: signature, expected: true},
+		{name: "bare hex as sent by gitea", secret: testWebhookSecret, payload: payload, signature: strings.TrimPrefix(signature, "sha256="), expected: true},
+		{name: "wrong secret", secret: "other", payload: payload, signature: signature, expected: false},
+		{name: "tampered payload", secret: testWebhookSecret, payload: payload + " ", signature: signature, expected: false},
+		{name: "not hex", secret: testWebhookSecret, payload: payload, signature: "sha256=zz", expected: false},
+		{name: "empty signature", secret: testWebhookSecret, payload: payload, signature: "", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := verifySignature(test.secret, []byte(test.payload), test.signature); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMatchesBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches []string
+		ref      string
+		expected bool
+	}{
+		{name: "exact branch", branches: []string{"main"}, ref: "refs/heads/main", expected: true},
+		{name: "other branch", branches: []string{"main"}, ref: "refs/heads/develop", expected: false},
+		{name: "glob", branches: []string{"release/*"}, ref: "refs/heads/release/1.2", expected: true},
+		{name: "glob does not cross slashes", branches: []string{"release/*"}, ref: "refs/heads/release/1.2/fix", expected: false},
+		{name: "tag with a branch name", branches: []string{"main"}, ref: "refs/tags/main", expected: false},
+		{name: "empty ref", branches: []string{"*"}, ref: "", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := matchesBranch(test.branches, test.ref); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDeliveryCache(t *testing.T) {
+	deliveryCache := NewDeliveryCache()
+	key := deliveryKey("deploy", []byte("payload"))
+
+	if key == deliveryKey("backup", []byte("payload")) || key == deliveryKey("deploy", []byte("other")) {
+		t.Fatal("expected delivery keys to depend on both the action and the payload")
+	}
+
+	if !deliveryCache.Remember(key) {
+		t.Fatal("expected the first delivery to be remembered")
+	}
+
+	if deliveryCache.Remember(key) {
+		t.Fatal("expected a repeated delivery to be rejected")
+	}
+
+	deliveryCache.Forget(key)
+	if !deliveryCache.Remember(key) {
+		t.Fatal("expected a forgotten delivery to be accepted again")
+	}
+}
+
+func TestHandleWebhook(t *testing.T) {
+	configuration := NewConfiguration()
+	configuration.Actions["deploy"] = models.Action{
+		Command: "true",
+		Webhook: &models.Webhook{Secret: testWebhookSecret, Events: []string{"push"}, Branches: []string{"main"}},
+	}
+	configuration.Actions["plain"] = models.Action{Command: "true"}
+
+	serverHandler := newTestServerHandler(configuration)
+	serverHandler.Server.deliveries = NewDeliveryCache()
+
+	router := chi.NewRouter()
+	router.Post("/hooks/{actionName}", serverHandler.handleWebhook)
+
+	tests := []struct {
+		name      string
+		action    string
+		payload   string
+		signature string
+		delivery  string
+		event     string
+		expected  int
+		message   string
+	}{
+		{name: "unknown action", action: "missing", expected: http.StatusNotFound},
+		{name: "action without webhook", action: "plain", expected: http.StatusNotFound},
+		{name: "missing signature", action: "deploy", payload: `{}`, delivery: "1", expected: http.StatusUnauthorized},
+		{name: "bad signature", action: "deploy", payload: `{}`, signature: signPayload("other", `{}`), delivery: "1", expected: http.StatusUnauthorized},
+		{name: "missing delivery id", action: "deploy", payload: `{}`, signature: signPayload(testWebhookSecret, `{}`), expected: http.StatusBadRequest},
+		{name: "ping", action: "deploy", payload: `{"zen":"ping"}`, signature: signPayload(testWebhookSecret, `{"zen":"ping"}`), delivery: "2", event: "ping", expected: http.StatusOK, message: "pong"},
+		{name: "replayed payload with a new delivery id", action: "deploy", payload: `{"zen":"ping"}`, signature: signPayload(testWebhookSecret, `{"zen":"ping"}`), delivery: "3", event: "ping", expected: http.StatusConflict},
+		{name: "ignored event", action: "deploy", payload: `{"ref":"refs/heads/main"}`, signature: signPayload(testWebhookSecret, `{"ref":"refs/heads/main"}`), delivery: "4", event: "issues", expected: http.StatusOK, message: "Event 'issues' ignored"},
+		{name: "ignored branch", action: "deploy", payload: `{"ref":"refs/heads/dev"}`, signature: signPayload(testWebhookSecret, `{"ref":"refs/heads/dev"}`), delivery: "5", event: "push", expected: http.StatusOK, message: "Ref 'refs/heads/dev' ignored"},
+		{name: "invalid JSON with a branch filter", action: "deploy", payload: `not json`, signature: signPayload(testWebhookSecret, `not json`), delivery: "6", event: "push", expected: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/hooks/"+test.action, strings.NewReader(test.payload))
+			if test.signature != "" {
+				request.Header.Set("X-Hub-Signature-256", test.signature)
+			}
+			if test.delivery != "" {
+				request.Header.Set("X-GitHub-Delivery", test.delivery)
+			}
+			if test.event != "" {
+				request.Header.Set("X-GitHub-Event", test.event)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expected {
+				t.Fatalf("expected status %d, got %d: %s", test.expected, recorder.Code, recorder.Body.String())
+			}
+
+			if test.message != "" && !strings.Contains(recorder.Body.String(), test.message) {
+				t.Fatalf("expected body to contain %q, got %s", test.message, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+// ActionResolver looks up the actions that workflow steps refer to.
+type ActionResolver func(name string) (models.Action, bool)
+
+// StepRunner runs the action of a workflow step. The server runs steps as
+// jobs of their own, so that they follow the action's concurrency policy and
+// take a slot of the global limit like any other run.
+type StepRunner func(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse
+
+// executeWorkflow runs the steps from the first one, following the on_success
+// and on_failure edges. The workflow fails when any step that ran failed, even
+// when an on_failure step handled it.
+func (executor *Executor) executeWorkflow(ctx context.Context, execution Execution, listener OutputListener) models.ApiResponse {
+	steps := execution.Action.Workflow
+	stepIndexes := make(map[string]int, len(steps))
+	for index, step := range steps {
+		stepIndexes[step.Name] = index
+	}
+
+	var stepResults []models.StepResult
+	var failedStep *models.StepResult
+
+	for index := 0; index >= 0 && ctx.Err() == nil; {
+		succeeded := true
+		for _, stepResult := range executor.executeStep(ctx, execution, steps[index], listener) {
+			stepResults = append(stepResults, stepResult)
+			if !stepResult.Success {
+				succeeded = false
+				if failedStep == nil {
+					failedStep = &stepResult
+				}
+			}
+		}
+
+		index = nextWorkflowStep(steps, stepIndexes, index, succeeded)
+	}
+
+	return workflowResult(ctx, execution.Action, stepResults, failedStep)
+}
+
+// nextWorkflowStep returns the index of the step to run after the one at
+// index, or -1 when the workflow ends there.
+func nextWorkflowStep(steps []models.WorkflowStep, stepIndexes map[string]int, index int, succeeded bool) int {
+	target := steps[index].OnFailure
+	if succeeded {
+		target = steps[index].OnSuccess
+		if target == "" && index+1 < len(steps) {
+			return index + 1
+		}
+	}
+
+	next, exists := stepIndexes[target]
+	if !exists {
+		return -1
+	}
+
+	return next
+}
+
+// executeStep runs the step's action, or all of its parallel actions at once.
+func (executor *Executor) executeStep(ctx context.Context, execution Execution, step models.WorkflowStep, listener OutputListener) []models.StepResult {
+	actionNames := step.Actions()
+	stepResults := make([]models.StepResult, len(actionNames))
+
+	var waitGroup sync.WaitGroup
+	for index, actionName := range actionNames {
+		label := step.Name
+		if len(step.Parallel) > 0 {
+			label = step.Name + "/" + actionName
+		}
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			stepResults[index] = executor.executeStepAction(ctx, execution, step, actionName, prefixOutput(listener, label))
+		}()
+	}
+	waitGroup.Wait()
+
+	return stepResults
+}
+
+func (executor *Executor) executeStepAction(ctx context.Context, execution Execution, step models.WorkflowStep, actionName string, listener OutputListener) models.StepResult {
+	stepResult := models.StepResult{
+		Step:     step.Name,
+		Action:   actionName,
+		ExitCode: -1,
+	}
+
+	var action models.Action
+	var exists bool
+	if executor.resolveAction != nil {
+		action, exists = executor.resolveAction(actionName)
+	}
+
+	if !exists {
+		stepResult.Message = fmt.Sprintf("action not found: %s", actionName)
+		return stepResult
+	}
+
+	if action.IsWorkflow() {
+		stepResult.Message = fmt.Sprintf("action '%s' is a workflow, nested workflows are not supported", actionName)
+		return stepResult
+	}
+
+	if step.Timeout > 0 {
+		action.Timeout = step.Timeout
+	}
+
+	values := make(map[string]string, len(step.Params))
+	for name, value := range step.Params {
+		values[name] = placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			return execution.Parameters[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+		})
+	}
+
+	parameters, err := executor.validator.ValidateParameters(action, values)
+	if err != nil {
+		stepResult.Message = err.Error()
+		return stepResult
+	}
+
+	// The workflow's env fills in what the step's action does not set itself,
+	// while trigger variables such as DSW_TRIGGER reach every step.
+	environment := make(map[string]string, len(execution.Action.Env)+len(execution.Environment))
+	for name, value := range execution.Action.Env {
+		if _, ownValue := action.Env[name]; !ownValue {
+			environment[name] = value
+		}
+	}
+	maps.Copy(environment, execution.Environment)
+
+	stepExecution := Execution{
+		ActionName:  actionName,
+		Action:      action,
+		Parameters:  parameters,
+		Environment: environment,
+		Source:      SourceWorkflow,
+		Caller:      execution.ActionName,
+		RequestID:   execution.RequestID,
+	}
+
+	var result models.ApiResponse
+	if executor.runStep != nil {
+		result = executor.runStep(ctx, stepExecution, listener)
+	} else {
+		result = executor.ExecuteStreaming(ctx, stepExecution, listener)
+	}
+
+	stepResult.Success = result.Success
+	stepResult.Output = result.Output
+	stepResult.Message = result.Message
+	stepResult.ExitCode = result.ExitCode
+	stepResult.TimedOut = result.TimedOut
+	stepResult.Cancelled = result.Cancelled
+	stepResult.DurationMs = result.DurationMs
+	return stepResult
+}
+
+// prefixOutput tags each streamed line with the step it comes from, since
+// parallel steps interleave their output.
+func prefixOutput(listener OutputListener, label string) OutputListener {
+	if listener == nil {
+		return nil
+	}
+
+	return func(stream string, line string) {
+		listener(stream, "["+label+"] "+line)
+	}
+}
+
+func workflowResult(ctx context.Context, action models.Action, stepResults []models.StepResult, failedStep *models.StepResult) models.ApiResponse {
+	var output strings.Builder
+	for _, stepResult := range stepResults {
+		fmt.Fprintf(&output, "==> %s (%s): %s\n", stepResult.Step, stepResult.Action, stepResult.Message)
+		if stepResult.Output != "" {
+			output.WriteString(strings.TrimSuffix(stepResult.Output, "\n") + "\n")
+		}
+	}
+
+	result := models.ApiResponse{
+		Output: output.String(),
+		Steps:  stepResults,
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.Message = fmt.Sprintf("Workflow timed out after %s", timeoutOf(action))
+		result.ExitCode = -1
+		result.TimedOut = true
+	case ctx.Err() != nil:
+		result.Message = "Workflow cancelled"
+		result.ExitCode = -1
+		result.Cancelled = true
+	case failedStep != nil:
+		result.Message = fmt.Sprintf("Workflow failed at step '%s': %s", failedStep.Step, failedStep.Message)
+		result.ExitCode = failedStep.ExitCode
+	default:
+		result.Success = true
+		result.Message = "Workflow completed successfully"
+	}
+
+	return result
+}
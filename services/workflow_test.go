@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/albertoboccolini/dsw/models"
+)
+
+func newTestWorkflowExecutor(actions map[string]models.Action) *Executor {
+	return NewExecutor(nil, NewValidator(), func(name string) (models.Action, bool) {
+		action, exists := actions[name]
+		return action, exists
+	}, nil)
+}
+
+func TestExecuteWorkflow(t *testing.T) {
+	actions := map[string]models.Action{
+		"pass": {Command: "true"},
+		"fail": {Command: "exit 3"},
+	}
+
+	tests := []struct {
+		name          string
+		steps         []models.WorkflowStep
+		expectedSteps []string
+		success       bool
+		message       string
+	}{
+		{
+			name:          "steps run in order",
+			steps:         []models.WorkflowStep{{Name: "build", Action: "pass"}, {Name: "deploy", Action: "pass"}},
+			expectedSteps: []string{"build", "deploy"},
+			success:       true,
+			message:       "Workflow completed successfully",
+		},
+		{
+			name:          "a failed step ends the workflow",
+			steps:         []models.WorkflowStep{{Name: "build", Action: "fail"}, {Name: "deploy", Action: "pass"}},
+			expectedSteps: []string{"build"},
+			message:       "Workflow failed at step 'build'",
+		},
+		{
+			name: "on_failure runs the handler and still fails",
+			steps: []models.WorkflowStep{
+				{Name: "build", Action: "fail", OnFailure: "alert"},
+				{Name: "deploy", Action: "pass"},
+				{Name: "alert", Action: "pass"},
+			},
+			expectedSteps: []string{"build", "alert"},
+			message:       "Workflow failed at step 'build'",
+		},
+		{
+			name: "on_success skips ahead",
+			steps: []models.WorkflowStep{
+				{Name: "check", Action: "pass", OnSuccess: "deploy"},
+				{Name: "build", Action: "fail"},
+				{Name: "deploy", Action: "pass"},
+			},
+			expectedSteps: []string{"check", "deploy"},
+			success:       true,
+		},
+		{
+			name: "on_success can end the workflow",
+			steps: []models.WorkflowStep{
+				{Name: "check", Action: "pass", OnSuccess: models.WorkflowEnd},
+				{Name: "build", Action: "fail"},
+			},
+			expectedSteps: []string{"check"},
+			success:       true,
+		},
+		{
+			name:          "parallel actions all run",
+			steps:         []models.WorkflowStep{{Name: "checks", Parallel: []string{"pass", "fail"}}, {Name: "deploy", Action: "pass"}},
+			expectedSteps: []string{"checks", "checks"},
+			message:       "Workflow failed at step 'checks'",
+		},
+		{
+			name:          "unknown step action",
+			steps:         []models.WorkflowStep{{Name: "build", Action: "missing"}},
+			expectedSteps: []string{"build"},
+			message:       "action not found: missing",
+		},
+	}
+
+	executor := newTestWorkflowExecutor(actions)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := executor.Execute(context.Background(), Execution{
+				ActionName: "release",
+				Action:     models.Action{Workflow: test.steps},
+			})
+
+			stepNames := make([]string, 0, len(result.Steps))
+			for _, stepResult := range result.Steps {
+				stepNames = append(stepNames, stepResult.Step)
+			}
+
+			if !slices.Equal(stepNames, test.expectedSteps) {
+				t.Fatalf("expected steps %v, got %v", test.expectedSteps, stepNames)
+			}
+
+			if result.Success != test.success {
+				t.Fatalf("expected success %v, got %v: %s", test.success, result.Success, result.Message)
+			}
+
+			if !strings.Contains(result.Message, test.message) {
+				t.Fatalf("expected message to contain %q, got %q", test.message, result.Message)
+			}
+		})
+	}
+}
+
+func TestWorkflowStepEnvironment(t *testing.T) {
+	executor := newTestWorkflowExecutor(map[string]models.Action{
+		"print": {Command: `echo "$A $B $DSW_TRIGGER"`, Env: map[string]string{"A": "action"}},
+	})
+
+	result := executor.Execute(context.Background(), Execution{
+		ActionName: "release",
+		Action: models.Action{
+			Env:      map[string]string{"A": "workflow", "B": "workflow"},
+			Workflow: []models.WorkflowStep{{Name: "print", Action: "print"}},
+		},
+		Environment: map[string]string{"DSW_TRIGGER": "schedule"},
+	})
+
+	if !result.Success {
+		t.Fatalf("expected the workflow to succeed: %s", result.Message)
+	}
+
+	if output := strings.TrimSpace(result.Steps[0].Output); output != "action workflow schedule" {
+		t.Fatalf("expected the action's own env to win, got %q", output)
+	}
+}